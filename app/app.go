@@ -6,8 +6,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -26,11 +28,14 @@ import (
 	"github.com/abiosoft/colima/util"
 	"github.com/docker/go-units"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 type App interface {
 	Active() bool
-	Start(config.Config) error
+	Start(config.Config, StartOptions) error
+	Reconfigure(config.Config, config.Changes) error
+	Plan(config.Config) error
 	Stop(force bool) error
 	Delete(data, force bool) error
 	SSH(args ...string) error
@@ -39,23 +44,27 @@ type App interface {
 	Runtime() (string, error)
 	Update() error
 	Kubernetes() (environment.Container, error)
+	DiskUsage() (DiskUsage, error)
 }
 
 var _ App = (*colimaApp)(nil)
 
 // New creates a new app.
 func New() (App, error) {
-	guest := lima.New(host.New())
+	h := host.New()
+	guest := lima.New(h)
 	if err := host.IsInstalled(guest); err != nil {
 		return nil, fmt.Errorf("dependency check failed for VM: %w", err)
 	}
 
 	return &colimaApp{
+		host:  h,
 		guest: guest,
 	}, nil
 }
 
 type colimaApp struct {
+	host  environment.HostActions
 	guest environment.VM
 }
 
@@ -100,94 +109,282 @@ func (c colimaApp) startWithRuntime(conf config.Config) ([]environment.Container
 	return containers, nil
 }
 
-func (c colimaApp) Start(conf config.Config) error {
-	ctx := context.WithValue(context.Background(), config.CtxKey(), conf)
+// Rollback modes for a failed start.
+const (
+	// RollbackNone leaves the changes of the failed start as is.
+	RollbackNone = "none"
+	// RollbackRestore reverts the changes on the host e.g. docker and kubernetes contexts, configs.
+	RollbackRestore = "restore"
+	// RollbackStop reverts the changes on the host, including the config of the VM, and stops the VM.
+	RollbackStop = "stop"
+)
+
+// RollbackModes returns the valid rollback modes.
+func RollbackModes() []string { return []string{RollbackNone, RollbackRestore, RollbackStop} }
+
+// StartOptions are the options for starting.
+type StartOptions struct {
+	// Rollback is the rollback mode if the start fails.
+	// Defaults to RollbackRestore.
+	Rollback string
+}
+
+func (c colimaApp) Start(conf config.Config, opts StartOptions) error {
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.recordHistory("start", func() config.Config { return conf }, func() error {
+		stage := cli.StartStage(config.AppName, "start")
+
+		ctx := context.WithValue(context.Background(), config.CtxKey(), conf)
+		ctx, rollback := cli.WithRollback(ctx)
+		rollback.StopVM = opts.Rollback == RollbackStop
+		rollback.Disabled = opts.Rollback == RollbackNone
 
+		err := c.start(ctx, conf)
+		if err != nil && opts.Rollback != RollbackNone {
+			c.rollback(ctx, rollback, opts.Rollback == RollbackStop)
+		}
+
+		return stage.End(err)
+	})
+}
+
+// rollback reverts the changes of a failed start, and stops the VM if stop is true.
+func (c colimaApp) rollback(ctx context.Context, rollback *cli.Rollback, stop bool) {
+	log.Println("reverting changes ...")
+	stage := cli.StartStage(config.AppName, "rollback")
+
+	if err := rollback.Run(); err != nil {
+		err = fmt.Errorf("error reverting changes: %w", err)
+		cli.EmitWarning(config.AppName, err)
+		log.Warnln(err)
+	}
+
+	if stop && c.guest.Running(ctx) {
+		log.Println("stopping vm ...")
+		if err := c.guest.Stop(ctx, false); err != nil {
+			err = fmt.Errorf("error stopping vm: %w", err)
+			cli.EmitWarning(config.AppName, err)
+			log.Warnln(err)
+		}
+	}
+
+	_ = stage.End(nil)
+}
+
+func (c colimaApp) start(ctx context.Context, conf config.Config) error {
 	log.Println("starting", config.CurrentProfile().DisplayName)
 	// print the full path of current profile being used
 	log.Tracef("starting with config file: %s\n", config.CurrentProfile().File())
 
+	steps, err := c.startSteps(ctx, conf)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return err
+		}
+	}
+
+	log.Println("done")
+
+	if err := generateSSHConfig(conf.SSHConfig); err != nil {
+		log.Trace("error generating ssh_config: %w", err)
+	}
+	return nil
+}
+
+// startStep is a step of start.
+type startStep struct {
+	// name is the description of the step for the plan,
+	// steps without a name have nothing to do that is worth listing.
+	name string
+	run  func() error
+}
+
+// startSteps returns the steps of start in order, they are also the steps listed by Plan.
+// The order is:
+//
+//	pre-start hooks -> vm start -> container runtime provision -> container runtime start -> post-start hooks
+func (c colimaApp) startSteps(ctx context.Context, conf config.Config) ([]startStep, error) {
 	var containers []environment.Container
 	if !environment.IsNoneRuntime(conf.Runtime) {
 		cs, err := c.startWithRuntime(conf)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		containers = cs
 	}
 
-	// the order for start is:
-	//   vm start -> container runtime provision -> container runtime start
-
-	// start vm
-	if err := c.guest.Start(ctx, conf); err != nil {
-		return fmt.Errorf("error starting vm: %w", err)
+	hooksStep := func(event string) string {
+		if len(conf.Hooks.Event(event)) == 0 {
+			return ""
+		}
+		return "run " + event + " hooks"
+	}
+	scriptsStep := func(mode string) string {
+		for _, s := range conf.Provision {
+			if s.Mode == mode {
+				return "run " + mode + " provision scripts"
+			}
+		}
+		return ""
 	}
 
-	// run after-boot provision scripts
-	c.runProvisionScripts(conf, config.ProvisionModeAfterBoot)
+	steps := []startStep{
+		{name: hooksStep(config.HookPreStart), run: func() error {
+			return c.runHooks(conf, config.HookPreStart)
+		}},
+		{name: "start vm", run: func() error {
+			if err := c.guest.Start(ctx, conf); err != nil {
+				return fmt.Errorf("error starting vm: %w", err)
+			}
+			// DNS hosts applied to the running VM are superseded by the resolver of the started VM
+			if err := c.clearDNSHosts(); err != nil {
+				log.Warnln(err)
+			}
+			return nil
+		}},
+		{name: scriptsStep(config.ProvisionModeAfterBoot), run: func() error {
+			return c.runProvisionScripts(conf, config.ProvisionModeAfterBoot)
+		}},
+	}
 
 	// provision and start container runtimes
 	for _, cont := range containers {
 		log := log.WithField("context", cont.Name())
-		log.Println("provisioning ...")
-		if err := cont.Provision(ctx); err != nil {
-			return fmt.Errorf("error provisioning %s: %w", cont.Name(), err)
-		}
-		log.Println("starting ...")
-		if err := cont.Start(ctx); err != nil {
-			return fmt.Errorf("error starting %s: %w", cont.Name(), err)
-		}
-	}
+		steps = append(steps,
+			startStep{name: "provision " + cont.Name(), run: func() error {
+				log.Println("provisioning ...")
+				stage := cli.StartStage(cont.Name(), "provisioning")
+				if err := stage.End(cont.Provision(ctx)); err != nil {
+					return fmt.Errorf("error provisioning %s: %w", cont.Name(), err)
+				}
+				return nil
+			}},
+			startStep{name: "start " + cont.Name(), run: func() error {
+				log.Println("starting ...")
+				stage := cli.StartStage(cont.Name(), "starting")
+				if err := stage.End(cont.Start(ctx)); err != nil {
+					return fmt.Errorf("error starting %s: %w", cont.Name(), err)
+				}
+				c.restoreContainers(ctx, cont)
+				return nil
+			}},
+		)
+	}
+
+	steps = append(steps,
+		startStep{name: scriptsStep(config.ProvisionModeReady), run: func() error {
+			return c.runProvisionScripts(conf, config.ProvisionModeReady)
+		}},
+		startStep{run: func() error {
+			// persist the current runtime
+			if err := c.setRuntime(conf.Runtime); err != nil {
+				log.Error(fmt.Errorf("error persisting runtime settings: %w", err))
+			}
+			// persist the kubernetes config
+			if err := c.setKubernetes(conf.Kubernetes); err != nil {
+				log.Error(fmt.Errorf("error persisting kubernetes settings: %w", err))
+			}
+			return nil
+		}},
+		startStep{name: hooksStep(config.HookPostStart), run: func() error {
+			c.runHooksNonFatal(conf, config.HookPostStart)
+			return nil
+		}},
+	)
 
-	// run ready provision scripts
-	c.runProvisionScripts(conf, config.ProvisionModeReady)
+	return steps, nil
+}
 
-	// persist the current runtime
-	if err := c.setRuntime(conf.Runtime); err != nil {
-		log.Error(fmt.Errorf("error persisting runtime settings: %w", err))
-	}
+type startPlan struct {
+	Profile   string   `yaml:"profile"`
+	Steps     []string `yaml:"steps"`
+	Provision struct {
+		Lima   []config.Provision `yaml:"lima"`
+		Colima []config.Provision `yaml:"colima"`
+	} `yaml:"provision"`
+	VM environment.VMPlan `yaml:"vm"`
+}
 
-	// persist the kubernetes config
-	if err := c.setKubernetes(conf.Kubernetes); err != nil {
-		log.Error(fmt.Errorf("error persisting kubernetes settings: %w", err))
-	}
+func (c colimaApp) Plan(conf config.Config) error {
+	ctx := context.WithValue(context.Background(), config.CtxKey(), conf)
 
-	log.Println("done")
+	var plan startPlan
+	plan.Profile = config.CurrentProfile().ShortName
 
-	if err := generateSSHConfig(conf.SSHConfig); err != nil {
-		log.Trace("error generating ssh_config: %w", err)
+	steps, err := c.startSteps(ctx, conf)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if step.name != "" {
+			plan.Steps = append(plan.Steps, step.name)
+		}
 	}
-	return nil
-}
 
-func (c colimaApp) runProvisionScripts(conf config.Config, mode string) {
-	var failed bool
 	for _, s := range conf.Provision {
-		if s.Mode != mode {
-			continue
-		}
-		if err := c.guest.Run("sh", "-c", s.Script); err != nil {
-			failed = true
+		if s.IsColimaMode() {
+			plan.Provision.Colima = append(plan.Provision.Colima, s)
+		} else {
+			plan.Provision.Lima = append(plan.Provision.Lima, s)
 		}
 	}
-	if failed {
-		log.Warnln(fmt.Errorf("error running %s provision script(s)", mode))
+
+	vmPlan, err := c.guest.Plan(ctx, conf)
+	if err != nil {
+		return fmt.Errorf("error computing vm plan: %w", err)
+	}
+	plan.VM = vmPlan
+
+	enc := yaml.NewEncoder(cli.Stdout())
+	enc.SetIndent(2)
+	if err := enc.Encode(plan); err != nil {
+		return fmt.Errorf("error encoding plan: %w", err)
 	}
+	return enc.Close()
 }
 
 func (c colimaApp) Stop(force bool) error {
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	conf := hookConfig()
+	return c.recordHistory("stop", func() config.Config { return conf }, func() error {
+		stage := cli.StartStage(config.AppName, "stop")
+		return stage.End(c.stop(force))
+	})
+}
+
+func (c colimaApp) stop(force bool) error {
 	ctx := context.Background()
 	log.Println("stopping", config.CurrentProfile().DisplayName)
 
+	conf := hookConfig()
+
 	// the order for stop is:
-	//   container stop -> vm stop
+	//   pre-stop hooks -> container stop -> vm stop -> post-stop hooks
+
+	if c.guest.Running(ctx) {
+		c.runHooksNonFatal(conf, config.HookPreStop)
+	}
 
 	// stop container runtimes only if the guest is responsive
 	if c.guest.Running(ctx) && c.guestResponsive() {
 		containers, err := c.currentContainerEnvironments(ctx)
 		if err != nil {
-			log.Warnln(fmt.Errorf("error retrieving runtimes: %w", err))
+			err = fmt.Errorf("error retrieving runtimes: %w", err)
+			cli.EmitWarning(config.AppName, err)
+			log.Warnln(err)
 		}
 
 		// stop happens in reverse of start
@@ -197,14 +394,23 @@ func (c colimaApp) Stop(force bool) error {
 			log := log.WithField("context", cont.Name())
 			log.Println("stopping ...")
 
+			if !force && conf.Drain.IsEnabled() {
+				c.drainContainers(ctx, conf, cont)
+			}
+
+			stage := cli.StartStage(cont.Name(), "stopping")
 			if err := cont.Stop(ctx, force); err != nil {
 				// failure to stop a container runtime is not fatal
 				// it is only meant for graceful shutdown.
 				// the VM will shut down anyways.
-				log.Warnln(fmt.Errorf("error stopping %s: %w", cont.Name(), err))
+				err = fmt.Errorf("error stopping %s: %w", cont.Name(), err)
+				cli.EmitWarning(cont.Name(), err)
+				log.Warnln(err)
 			}
+			_ = stage.End(nil)
 		}
 	} else if c.guest.Running(ctx) {
+		cli.EmitWarning("vm", fmt.Errorf("vm not responsive, skipping runtime shutdown"))
 		log.Warnln("vm not responsive, skipping runtime shutdown")
 	}
 
@@ -214,6 +420,8 @@ func (c colimaApp) Stop(force bool) error {
 		return fmt.Errorf("error stopping vm: %w", err)
 	}
 
+	c.runHooksNonFatal(conf, config.HookPostStop)
+
 	log.Println("done")
 
 	if err := generateSSHConfig(false); err != nil {
@@ -223,12 +431,27 @@ func (c colimaApp) Stop(force bool) error {
 }
 
 func (c colimaApp) Delete(data, force bool) error {
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the state is removed by the deletion
+	conf := hookConfig()
+	return c.recordHistory("delete", func() config.Config { return conf }, func() error {
+		stage := cli.StartStage(config.AppName, "delete")
+		return stage.End(c.delete(data, force))
+	})
+}
+
+func (c colimaApp) delete(data, force bool) error {
 	confirmContainerDestruction := func() bool {
 		return cli.Prompt("\033[31m\033[1mthis will delete ALL container data. Are you sure you want to continue")
 	}
 
 	s, _ := store.Load()
-	diskInUse := s.DiskFormatted
+	diskInUse := len(s.RuntimeDisks) > 0
 
 	if !force {
 		y := cli.Prompt("are you sure you want to delete " + config.CurrentProfile().DisplayName + " and all settings")
@@ -248,6 +471,9 @@ func (c colimaApp) Delete(data, force bool) error {
 	ctx := context.Background()
 	log.Println("deleting", config.CurrentProfile().DisplayName)
 
+	// the config is deleted during teardown, retain it for the hooks
+	conf := hookConfig()
+
 	// the order for teardown is:
 	//   container teardown -> vm teardown
 
@@ -259,16 +485,22 @@ func (c colimaApp) Delete(data, force bool) error {
 	if c.guest.Running(ctx) {
 		containers, err := c.currentContainerEnvironments(ctx)
 		if err != nil {
-			log.Warnln(fmt.Errorf("error retrieving runtimes: %w", err))
+			err = fmt.Errorf("error retrieving runtimes: %w", err)
+			cli.EmitWarning(config.AppName, err)
+			log.Warnln(err)
 		}
 		for _, cont := range containers {
 			log := log.WithField("context", cont.Name())
 			log.Println("deleting ...")
 
+			stage := cli.StartStage(cont.Name(), "deleting")
 			if err := cont.Teardown(ctx); err != nil {
 				// failure here is not fatal
-				log.Warnln(fmt.Errorf("error during teardown of %s: %w", cont.Name(), err))
+				err = fmt.Errorf("error during teardown of %s: %w", cont.Name(), err)
+				cli.EmitWarning(cont.Name(), err)
+				log.Warnln(err)
 			}
+			_ = stage.End(nil)
 		}
 	}
 
@@ -276,17 +508,20 @@ func (c colimaApp) Delete(data, force bool) error {
 	if err := c.guest.Teardown(ctx); err != nil {
 		return fmt.Errorf("error during teardown of vm: %w", err)
 	}
+	resetVMState()
 
 	// delete configs
 	if err := configmanager.Teardown(); err != nil {
 		return fmt.Errorf("error deleting configs: %w", err)
 	}
 
-	// delete runtime disk if disk in use and data deletion is requested
+	// delete runtime disks if disk in use and data deletion is requested
 	if diskInUse && data {
 		log.Println("deleting container data")
-		if err := limautil.DeleteDisk(); err != nil {
-			return fmt.Errorf("error deleting container data: %w", err)
+		for _, runtime := range slices.Sorted(maps.Keys(s.RuntimeDisks)) {
+			if err := limautil.DeleteDisk(s.RuntimeDisks[runtime].Name); err != nil {
+				return fmt.Errorf("error deleting container data of %s: %w", runtime, err)
+			}
 		}
 
 		if err := store.Reset(); err != nil {
@@ -294,6 +529,8 @@ func (c colimaApp) Delete(data, force bool) error {
 		}
 	}
 
+	c.runHooksNonFatal(conf, config.HookPostDelete)
+
 	log.Println("done")
 
 	if err := generateSSHConfig(false); err != nil {
@@ -364,6 +601,8 @@ type statusInfo struct {
 	CPU              int    `json:"cpu"`
 	Memory           int64  `json:"memory"`
 	Disk             int64  `json:"disk"`
+
+	Provision []store.ProvisionResult `json:"provision,omitempty"`
 }
 
 func (c colimaApp) getStatus() (status statusInfo, err error) {
@@ -417,6 +656,11 @@ func (c colimaApp) Status(extended bool, jsonOutput bool) error {
 	if err != nil {
 		return err
 	}
+	if extended {
+		if s, err := store.Load(); err == nil {
+			status.Provision = s.ProvisionResults
+		}
+	}
 
 	if jsonOutput {
 		if err := json.NewEncoder(os.Stdout).Encode(status); err != nil {
@@ -465,6 +709,16 @@ func (c colimaApp) Status(extended bool, jsonOutput bool) error {
 			if status.Disk > 0 {
 				log.Println("disk:", units.BytesSize(float64(status.Disk)))
 			}
+			for _, p := range status.Provision {
+				line := fmt.Sprintf("provision: %s (%s) %s", p.Name, p.Mode, p.Status)
+				if p.Duration > 0 {
+					line += " in " + (time.Duration(p.Duration) * time.Millisecond).Round(time.Second/10).String()
+				}
+				if p.Error != "" {
+					line += ", " + p.Error
+				}
+				log.Println(line)
+			}
 		}
 	}
 	return nil
@@ -517,17 +771,6 @@ func (c colimaApp) currentRuntime(ctx context.Context) (string, error) {
 }
 
 func (c colimaApp) setRuntime(runtime string) error {
-	err := store.Set(func(s *store.Store) {
-		// update runtime if runtime disk is in use
-		if s.DiskFormatted {
-			s.DiskRuntime = runtime
-		}
-	})
-
-	if err != nil {
-		log.Traceln(fmt.Errorf("error persisting store: %w", err))
-	}
-
 	return c.guest.Set(environment.ContainerRuntimeKey, runtime)
 }
 
@@ -593,6 +836,16 @@ func (c colimaApp) Active() bool {
 }
 
 func (c *colimaApp) Update() error {
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.recordHistory("update", hookConfig, c.update)
+}
+
+func (c *colimaApp) update() error {
 	ctx := context.Background()
 	if !c.guest.Running(ctx) {
 		return fmt.Errorf("runtime cannot be updated, %s is not running", config.CurrentProfile().DisplayName)
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/incus"
+	"github.com/abiosoft/colima/environment/vm/lima"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/store"
+	"github.com/abiosoft/colima/util/fsutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// DiskUsage is the disk usage of the instance.
+type DiskUsage struct {
+	// Host are the disk images on the host.
+	Host []HostDiskUsage `json:"host"`
+
+	// the usage in the VM is only retrieved while the VM is running
+	Runtime     string                     `json:"runtime,omitempty"`
+	Filesystems []limautil.FilesystemUsage `json:"filesystems,omitempty"`
+	Directories []DirectoryUsage           `json:"directories,omitempty"`
+	// RuntimeUsage is the output of the container runtime e.g. 'docker system df'.
+	RuntimeUsage string `json:"runtime_usage,omitempty"`
+}
+
+// HostDiskUsage is the usage of a disk image on the host.
+type HostDiskUsage struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	// Size is the apparent size of the file in bytes.
+	Size int64 `json:"size"`
+	// Allocated is the space allocated on the host in bytes, less than the size for sparse files.
+	Allocated int64 `json:"allocated"`
+}
+
+// DirectoryUsage is the usage of a container runtime directory in the VM.
+type DirectoryUsage struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Used int64  `json:"used"`
+}
+
+func (c colimaApp) DiskUsage() (usage DiskUsage, err error) {
+	ctx := context.Background()
+	profile := config.CurrentProfile()
+	s, _ := store.Load()
+
+	// host
+	addHostDisk := func(name, file string) {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return
+		}
+		allocated, err := fsutil.AllocatedSize(file)
+		if err != nil {
+			allocated = stat.Size()
+		}
+		usage.Host = append(usage.Host, HostDiskUsage{Name: name, File: file, Size: stat.Size(), Allocated: allocated})
+	}
+	addHostDisk("basedisk", filepath.Join(profile.LimaInstanceDir(), "basedisk"))
+	addHostDisk("diffdisk", limautil.ColimaDiffDisk(profile.ID))
+	for _, runtime := range slices.Sorted(maps.Keys(s.RuntimeDisks)) {
+		addHostDisk("runtime/"+runtime, limautil.DiskFile(s.RuntimeDisks[runtime].Name))
+	}
+	if disks, err := limautil.DataDisks(); err == nil {
+		for _, d := range disks {
+			addHostDisk("disk/"+strings.TrimPrefix(d.Name, limautil.DataDiskName("")), filepath.Join(d.Dir, "datadisk"))
+		}
+	}
+
+	if !c.guest.Running(ctx) {
+		return usage, nil
+	}
+
+	// VM
+	runtime, err := c.currentRuntime(ctx)
+	if err != nil {
+		return usage, err
+	}
+	usage.Runtime = runtime
+
+	filesystems, err := limautil.FilesystemUsages("/", limautil.MountPoint())
+	if err != nil {
+		log.Warnln(err)
+	}
+	for _, mountPoint := range slices.Sorted(maps.Keys(filesystems)) {
+		usage.Filesystems = append(usage.Filesystems, filesystems[mountPoint])
+	}
+
+	dirs := lima.DataDisk(runtime).Dirs
+	var paths []string
+	for _, dir := range dirs {
+		paths = append(paths, dir.Path)
+	}
+	if len(paths) > 0 {
+		used, err := limautil.DirectoryUsages(paths...)
+		if err != nil {
+			log.Warnln(err)
+		}
+		for _, dir := range dirs {
+			if u, ok := used[dir.Path]; ok {
+				usage.Directories = append(usage.Directories, DirectoryUsage{Name: dir.Name, Path: dir.Path, Used: u})
+			}
+		}
+	}
+
+	var args []string
+	switch runtime {
+	case docker.Name:
+		args = []string{"sudo", "docker", "system", "df"}
+	case containerd.Name:
+		args = []string{"sudo", "nerdctl", "system", "df"}
+	case incus.Name:
+		args = []string{"sudo", "incus", "storage", "info", "default"}
+	}
+	if len(args) > 0 {
+		out, err := c.guest.RunOutput(args...)
+		if err != nil {
+			log.Warnf("error retrieving %s disk usage: %v", runtime, err)
+		}
+		usage.RuntimeUsage = out
+	}
+
+	return usage, nil
+}
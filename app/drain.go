@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// drainContainers gracefully stops the running containers of the container runtime
+// and records the containers to be started on next startup.
+// Failures are not fatal, the runtime is stopped afterwards regardless.
+func (c colimaApp) drainContainers(ctx context.Context, conf config.Config, cont environment.Container) {
+	drainer, ok := cont.(environment.Drainer)
+	if !ok {
+		return
+	}
+
+	log := log.WithField("context", cont.Name())
+	log.Println("stopping containers ...")
+
+	stage := cli.StartStage(cont.Name(), "draining")
+	result, err := drainer.Drain(ctx, conf.Drain.TimeoutDuration())
+	_ = stage.End(nil)
+
+	if err != nil {
+		err = fmt.Errorf("error stopping containers: %w", err)
+		cli.EmitWarning(cont.Name(), err)
+		log.Warnln(err)
+	}
+	if len(result.Killed) > 0 {
+		err := fmt.Errorf("containers killed after %v timeout: %s", conf.Drain.TimeoutDuration(), strings.Join(result.Killed, ", "))
+		cli.EmitWarning(cont.Name(), err)
+		log.Warnln(err)
+	}
+
+	if err := store.Set(func(s *store.Store) {
+		if s.DrainedContainers == nil {
+			s.DrainedContainers = map[string][]string{}
+		}
+		s.DrainedContainers[cont.Name()] = result.Restart
+	}); err != nil {
+		log.Warnln(fmt.Errorf("error persisting drained containers: %w", err))
+	}
+}
+
+// restoreContainers starts the containers of the container runtime
+// that were drained on the previous stop.
+func (c colimaApp) restoreContainers(ctx context.Context, cont environment.Container) {
+	drainer, ok := cont.(environment.Drainer)
+	if !ok {
+		return
+	}
+
+	s, _ := store.Load()
+	containers := s.DrainedContainers[cont.Name()]
+	if len(containers) == 0 {
+		return
+	}
+
+	log := log.WithField("context", cont.Name())
+	log.Println("restarting containers ...")
+	if err := drainer.Restore(ctx, containers); err != nil {
+		err = fmt.Errorf("error restarting containers: %w", err)
+		cli.EmitWarning(cont.Name(), err)
+		log.Warnln(err)
+	}
+
+	if err := store.Set(func(s *store.Store) { delete(s.DrainedContainers, cont.Name()) }); err != nil {
+		log.Warnln(fmt.Errorf("error persisting drained containers: %w", err))
+	}
+}
+
+// resetVMState clears the state in the store that is bound to the VM.
+func resetVMState() {
+	if err := store.Set(func(s *store.Store) {
+		s.ProvisionedScripts = nil
+		s.ProvisionResults = nil
+		s.DrainedContainers = nil
+	}); err != nil {
+		log.Trace(fmt.Errorf("error resetting store: %w", err))
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// history is the entry of the lifecycle command in progress, for recording its stages.
+var history struct {
+	entry *store.HistoryEntry
+	once  sync.Once
+	sync.Mutex
+}
+
+// recordStage records the stages of the lifecycle command in progress.
+func recordStage(e cli.Event) {
+	if e.Type != cli.EventStageEnd && e.Type != cli.EventFailure {
+		return
+	}
+	// failures without a stage are of the command itself
+	if e.Stage == "" {
+		return
+	}
+
+	history.Lock()
+	defer history.Unlock()
+	if history.entry == nil {
+		return
+	}
+	// the command itself is recorded as the entry
+	if e.Context == config.AppName && e.Stage == history.entry.Command {
+		return
+	}
+	history.entry.Stages = append(history.entry.Stages, store.HistoryStage{
+		Context:  e.Context,
+		Stage:    e.Stage,
+		Duration: e.Duration,
+		Failed:   e.Type == cli.EventFailure,
+	})
+}
+
+// recordHistory runs the lifecycle command and records it in the history of the profile.
+// conf is the config the command applies to, for the runtime and Kubernetes versions.
+func (c colimaApp) recordHistory(command string, conf func() config.Config, f func() error) error {
+	history.once.Do(func() { cli.OnEvent(recordStage) })
+
+	entry := store.HistoryEntry{
+		Time:          time.Now(),
+		Command:       command,
+		ColimaVersion: config.AppVersion().Version,
+	}
+	history.Lock()
+	history.entry = &entry
+	history.Unlock()
+
+	err := f()
+
+	history.Lock()
+	history.entry = nil
+	history.Unlock()
+
+	entry.Duration = time.Since(entry.Time).Milliseconds()
+	entry.Outcome = store.HistoryOutcomeSuccess
+	if err != nil {
+		entry.Outcome = store.HistoryOutcomeFailure
+		entry.Error = err.Error()
+	}
+	c.setHistoryVersions(&entry, conf(), err == nil)
+
+	if err := store.AppendHistory(entry); err != nil {
+		log.Traceln(fmt.Errorf("error recording history: %w", err))
+	}
+	return err
+}
+
+// setHistoryVersions sets the runtime and Kubernetes versions of the history entry.
+// The runtime version is only retrieved from the VM after a successful start or update,
+// it is otherwise retained from the previous entry for the runtime.
+func (c colimaApp) setHistoryVersions(entry *store.HistoryEntry, conf config.Config, succeeded bool) {
+	entry.Runtime = conf.Runtime
+	if conf.Kubernetes.Enabled {
+		entry.KubernetesVersion = conf.Kubernetes.Version
+	}
+	if entry.Runtime == "" || environment.IsNoneRuntime(entry.Runtime) {
+		return
+	}
+
+	if succeeded && (entry.Command == "start" || entry.Command == "update") {
+		if cont, err := c.containerEnvironment(entry.Runtime); err == nil {
+			entry.RuntimeVersion = serverVersion(cont.Version(context.Background()))
+			return
+		}
+	}
+
+	entries, _ := store.History()
+	for _, e := range slices.Backward(entries) {
+		if e.Runtime == entry.Runtime && e.RuntimeVersion != "" {
+			entry.RuntimeVersion = e.RuntimeVersion
+			return
+		}
+	}
+}
+
+// serverVersion returns the server version of the version output of a runtime,
+// or the first line if there is none.
+func serverVersion(version string) string {
+	lines := strings.Split(strings.TrimSpace(version), "\n")
+	for _, line := range lines {
+		key, v, ok := strings.Cut(line, ":")
+		if key = strings.ToLower(strings.TrimSpace(key)); ok && (key == "server" || key == "server version") {
+			return strings.TrimSpace(v)
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/incus"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// hookEnv returns the environment variables exported to the hooks.
+func hookEnv(conf config.Config, event string) []string {
+	profile := config.CurrentProfile()
+	env := []string{
+		"COLIMA_PROFILE=" + profile.ShortName,
+		"COLIMA_HOOK=" + event,
+		"COLIMA_RUNTIME=" + conf.Runtime,
+	}
+
+	// the VM is only reachable after start and before stop
+	switch event {
+	case config.HookPostStart, config.HookPreStop:
+		env = append(env, "COLIMA_IP_ADDRESS="+limautil.IPAddress(profile.ID))
+	}
+
+	switch conf.Runtime {
+	case docker.Name:
+		env = append(env,
+			"COLIMA_DOCKER_SOCKET=unix://"+docker.HostSocketFile(),
+			"COLIMA_CONTAINERD_SOCKET=unix://"+containerd.HostSocketFiles().Containerd,
+		)
+	case containerd.Name:
+		env = append(env, "COLIMA_CONTAINERD_SOCKET=unix://"+containerd.HostSocketFiles().Containerd)
+	case incus.Name:
+		env = append(env, "COLIMA_INCUS_SOCKET=unix://"+incus.HostSocketFile())
+	}
+
+	if conf.Kubernetes.Enabled {
+		env = append(env, "COLIMA_KUBE_CONTEXT="+profile.ID)
+	}
+
+	return env
+}
+
+// runHooks runs the host hooks configured for the event.
+// All hooks are run, the first error (if any) is returned.
+func (c colimaApp) runHooks(conf config.Config, event string) error {
+	hooks := conf.Hooks.Event(event)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	log := log.WithField("context", "hooks")
+	log.Println("running", event, "hooks ...")
+
+	stage := cli.StartStage("hooks", event)
+	host := c.host.WithEnv(hookEnv(conf, event)...)
+
+	var hookErr error
+	for _, hook := range hooks {
+		if err := host.Run("sh", "-c", hook); err != nil && hookErr == nil {
+			hookErr = fmt.Errorf("error running %s hook '%s': %w", event, hook, err)
+		}
+	}
+
+	return stage.End(hookErr)
+}
+
+// runHooksNonFatal runs the host hooks configured for the event
+// and logs a warning on failure.
+func (c colimaApp) runHooksNonFatal(conf config.Config, event string) {
+	if err := c.runHooks(conf, event); err != nil {
+		cli.EmitWarning("hooks", err)
+		log.Warnln(err)
+	}
+}
+
+// hookConfig returns the config of the current instance for the hooks.
+func hookConfig() config.Config {
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		log.Trace(fmt.Errorf("error loading instance config for hooks: %w", err))
+	}
+	return conf
+}
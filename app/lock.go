@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/fsutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// LockWait is if lifecycle commands wait for a lifecycle command of another process
+// on the same profile to finish, instead of failing.
+var LockWait = true
+
+// profileLock is the lock of the current profile held by the process.
+var profileLock struct {
+	count  int
+	unlock func()
+	sync.Mutex
+}
+
+// Lock acquires the lock of the current profile against concurrent lifecycle commands
+// of other processes, see LockWait. The lock is reentrant within the process,
+// e.g. for restart composed of stop and start. The returned function releases the lock.
+func Lock() (unlock func(), err error) {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	if profileLock.count == 0 {
+		profileLock.unlock, err = lockProfile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	profileLock.count++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			profileLock.Lock()
+			defer profileLock.Unlock()
+			if profileLock.count--; profileLock.count == 0 {
+				profileLock.unlock()
+				profileLock.unlock = nil
+			}
+		})
+	}, nil
+}
+
+func lockProfile() (func(), error) {
+	profile := config.CurrentProfile()
+	file := profile.LockFile()
+
+	unlock, err := fsutil.LockPath(file, false)
+	var held fsutil.HeldError
+	if !errors.As(err, &held) {
+		if err != nil {
+			return nil, fmt.Errorf("error locking %s: %w", profile.DisplayName, err)
+		}
+		return unlock, nil
+	}
+
+	holder := "another process"
+	if held.Holder != nil {
+		holder = held.Holder.String()
+	}
+	if !LockWait {
+		return nil, fmt.Errorf("%s is in use by %s, retry when it is done or use --wait", profile.DisplayName, holder)
+	}
+
+	log.Printf("waiting for %s to finish with %s ...", holder, profile.DisplayName)
+	unlock, err = fsutil.LockPath(file, true)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", profile.DisplayName, err)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/store"
+	"github.com/abiosoft/colima/util/shautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// exit code of the timeout command when the command times out.
+const timeoutExitCode = 124
+
+// runProvisionScripts runs the provision scripts for the mode and persists the results.
+// An error is only returned if a script with the abort failure policy does not succeed.
+func (c colimaApp) runProvisionScripts(conf config.Config, mode string) error {
+	scripts, err := conf.ProvisionScripts(mode)
+	if err != nil {
+		return fmt.Errorf("error in provision scripts: %w", err)
+	}
+
+	s, _ := store.Load()
+
+	// results of scripts in earlier modes are needed for dependencies
+	succeeded := map[string]bool{}
+	for _, r := range s.ProvisionResults {
+		if r.Mode != mode {
+			succeeded[r.Name] = r.Succeeded()
+		}
+	}
+
+	var results []store.ProvisionResult
+	var provisioned []string
+	var abortErr error
+
+	if len(scripts) > 0 {
+		stage := cli.StartStage("provision", mode)
+
+		for _, script := range scripts {
+			result := c.runProvisionScript(script, s.ProvisionedScripts, succeeded)
+			results = append(results, result)
+			succeeded[script.Name] = result.Succeeded()
+
+			if result.Status == store.ProvisionStatusOK && script.Once {
+				provisioned = append(provisioned, provisionHash(script))
+			}
+			if result.Succeeded() {
+				continue
+			}
+
+			err := fmt.Errorf("%s provision script '%s' %s", mode, script.Name, result.Status)
+			if result.Error != "" {
+				err = fmt.Errorf("%w: %s", err, result.Error)
+			}
+			if script.AbortOnFailure() {
+				abortErr = err
+				break
+			}
+			cli.EmitWarning("provision", err)
+			log.Warnln(err)
+		}
+
+		_ = stage.End(abortErr)
+	}
+
+	if err := store.Set(func(s *store.Store) {
+		s.ProvisionResults = slices.DeleteFunc(s.ProvisionResults, func(r store.ProvisionResult) bool {
+			return r.Mode == mode
+		})
+		s.ProvisionResults = append(s.ProvisionResults, results...)
+		s.ProvisionedScripts = append(s.ProvisionedScripts, provisioned...)
+	}); err != nil {
+		log.Warnln(fmt.Errorf("error persisting provision results: %w", err))
+	}
+
+	return abortErr
+}
+
+// runProvisionScript runs the provision script in the guest.
+// provisioned are the hashes of run-once scripts that have already succeeded,
+// succeeded are the scripts that have succeeded by name.
+func (c colimaApp) runProvisionScript(script config.Provision, provisioned []string, succeeded map[string]bool) store.ProvisionResult {
+	result := store.ProvisionResult{Name: script.Name, Mode: script.Mode}
+
+	if script.Once && slices.Contains(provisioned, provisionHash(script)) {
+		result.Status = store.ProvisionStatusDone
+		return result
+	}
+
+	for _, dep := range script.DependsOn {
+		if !succeeded[dep] {
+			result.Status = store.ProvisionStatusSkipped
+			result.Error = fmt.Sprintf("dependency '%s' did not succeed", dep)
+			return result
+		}
+	}
+
+	args := []string{"sh", "-c", script.Script}
+	if timeout, _ := script.TimeoutDuration(); timeout > 0 {
+		args = append([]string{"timeout", strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64) + "s"}, args...)
+	}
+
+	log.WithField("context", "provision").Println("running", script.Name, "...")
+	start := time.Now()
+	err := c.guest.Run(args...)
+	result.Duration = time.Since(start).Milliseconds()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Status = store.ProvisionStatusOK
+	case script.Timeout != "" && errors.As(err, &exitErr) && exitErr.ExitCode() == timeoutExitCode:
+		result.Status = store.ProvisionStatusTimeout
+		result.Error = "timed out after " + script.Timeout
+	default:
+		result.Status = store.ProvisionStatusFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// provisionHash returns the hash used to track run-once provision scripts.
+func provisionHash(script config.Provision) string {
+	return shautil.SHA256(script.Mode + "\n" + script.Script).String()
+}
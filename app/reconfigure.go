@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/kubernetes"
+	log "github.com/sirupsen/logrus"
+)
+
+func (c colimaApp) Reconfigure(conf config.Config, changes config.Changes) error {
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stage := cli.StartStage(config.AppName, "reconfigure")
+	return stage.End(c.reconfigure(conf, changes))
+}
+
+// reconfigure applies live and runtime restart changes to the running instance.
+func (c colimaApp) reconfigure(conf config.Config, changes config.Changes) error {
+	if class := changes.Class(); class > config.ChangeRuntimeRestart {
+		return fmt.Errorf("changes require a %s and cannot be applied to the running instance", class)
+	}
+
+	ctx := context.WithValue(context.Background(), config.CtxKey(), conf)
+	if !c.guest.Running(ctx) {
+		return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+	}
+	log.Println("applying changes to", config.CurrentProfile().DisplayName)
+
+	if changes.Has("network.dnsHosts") {
+		if err := c.applyDNSHosts(conf.Network.DNSHosts); err != nil {
+			return err
+		}
+	}
+
+	containers, err := c.currentContainerEnvironments(ctx)
+	if err != nil {
+		return fmt.Errorf("error retrieving runtimes: %w", err)
+	}
+
+	// re-provisioning the runtime applies the daemon config and contexts
+	if len(containers) > 0 && (changes.Has("docker") || changes.Has("autoActivate")) {
+		cont := containers[0]
+		log.WithField("context", cont.Name()).Println("provisioning ...")
+		stage := cli.StartStage(cont.Name(), "provisioning")
+		if err := stage.End(cont.Provision(ctx)); err != nil {
+			return fmt.Errorf("error provisioning %s: %w", cont.Name(), err)
+		}
+	}
+
+	if changes.Has("kubernetes") {
+		if err := c.restartKubernetes(ctx, conf); err != nil {
+			return err
+		}
+	}
+
+	// persist the applied config as the state of the instance
+	if err := configmanager.SaveState(conf, config.CurrentProfile().StateFile()); err != nil {
+		log.Warnln(fmt.Errorf("error persisting Colima state: %w", err))
+	}
+
+	log.Println("done")
+
+	if err := generateSSHConfig(conf.SSHConfig); err != nil {
+		log.Trace("error generating ssh_config: %w", err)
+	}
+	return nil
+}
+
+// restartKubernetes stops kubernetes and starts it again if enabled in the config.
+func (c colimaApp) restartKubernetes(ctx context.Context, conf config.Config) error {
+	kube, err := c.containerEnvironment(kubernetes.Name)
+	if err != nil {
+		return err
+	}
+	log := log.WithField("context", kube.Name())
+
+	if kube.Running(ctx) {
+		log.Println("stopping ...")
+		stage := cli.StartStage(kube.Name(), "stopping")
+		if err := stage.End(kube.Stop(ctx, false)); err != nil {
+			return fmt.Errorf("error stopping %s: %w", kube.Name(), err)
+		}
+	}
+
+	if conf.Kubernetes.Enabled {
+		log.Println("provisioning ...")
+		stage := cli.StartStage(kube.Name(), "provisioning")
+		if err := stage.End(kube.Provision(ctx)); err != nil {
+			return fmt.Errorf("error provisioning %s: %w", kube.Name(), err)
+		}
+		log.Println("starting ...")
+		stage = cli.StartStage(kube.Name(), "starting")
+		if err := stage.End(kube.Start(ctx)); err != nil {
+			return fmt.Errorf("error starting %s: %w", kube.Name(), err)
+		}
+	}
+
+	return c.setKubernetes(conf.Kubernetes)
+}
+
+// clearDNSHosts removes the DNS hosts applied by applyDNSHosts from the /etc/hosts file of the VM.
+// The entries would otherwise override the DNS hosts of the config after a VM restart.
+func (c colimaApp) clearDNSHosts() error { return c.applyDNSHosts(nil) }
+
+// marker for the /etc/hosts entries managed by colima.
+const dnsHostsMarker = "# colima dnsHosts"
+
+// applyDNSHosts replaces the DNS hosts in the /etc/hosts file of the VM.
+// The internal resolver only picks up the hosts on VM restart.
+func (c colimaApp) applyDNSHosts(hosts map[string]string) error {
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	script := []string{fmt.Sprintf("sed -i '/%s$/d' /etc/hosts", dnsHostsMarker)}
+	for _, name := range names {
+		target := hosts[name]
+		ip := fmt.Sprintf("$(getent ahostsv4 %q | awk '{print $1; exit}')", target)
+		if net.ParseIP(target) != nil {
+			ip = target
+		}
+		script = append(script, fmt.Sprintf(`echo "%s %s %s" >> /etc/hosts`, ip, name, dnsHostsMarker))
+	}
+
+	if err := c.guest.RunQuiet("sudo", "sh", "-c", strings.Join(script, " && ")); err != nil {
+		return fmt.Errorf("error applying dns hosts: %w", err)
+	}
+	return nil
+}
@@ -36,6 +36,7 @@ func New(name string) CommandChain {
 type cFunc struct {
 	f func() error
 	s string
+	u func() error
 }
 
 // CommandChain is a chain of commands.
@@ -67,17 +68,31 @@ func (n *namedCommandChain) Logger(ctx context.Context) *log.Entry {
 }
 
 func (n *namedCommandChain) Init(ctx context.Context) *ActiveCommandChain {
+	quiet, _ := ctx.Value(CtxKeyQuiet).(bool)
+	rollback, _ := ctx.Value(ctxKeyRollback).(*Rollback)
 	return &ActiveCommandChain{
-		log: n.Logger(ctx),
+		name:     n.name,
+		quiet:    quiet,
+		rollback: rollback,
+		log:      n.Logger(ctx),
 	}
 }
 
 // ActiveCommandChain is an active command chain.
 type ActiveCommandChain struct {
+	name      string
 	funcs     []cFunc
 	lastStage string
 	log       *log.Entry
 
+	// the stage in progress, for lifecycle events
+	stage *Stage
+
+	// undo actions of the executed functions
+	undo     []func() error
+	rollback *Rollback
+
+	quiet     bool
 	executing bool
 }
 
@@ -93,11 +108,24 @@ func (a *ActiveCommandChain) Add(f func() error) {
 func (a *ActiveCommandChain) Stage(s string) {
 	if a.executing {
 		a.log.Println(s, "...")
+		a.startStage(s)
 		return
 	}
 	a.funcs = append(a.funcs, cFunc{s: s})
 }
 
+// Undo adds an undo action for the functions added before it.
+// If a later function terminates the chain, the undo actions are run in reverse order,
+// unless the rollback in the context of the chain is disabled.
+// Otherwise, they are handed over to the rollback in the context of the chain (if any).
+func (a *ActiveCommandChain) Undo(f func() error) {
+	if a.executing {
+		a.undo = append(a.undo, f)
+		return
+	}
+	a.funcs = append(a.funcs, cFunc{u: f})
+}
+
 // Stagef is like stage with string format.
 func (a *ActiveCommandChain) Stagef(format string, s ...any) {
 	f := fmt.Sprintf(format, s...)
@@ -112,10 +140,14 @@ func (a *ActiveCommandChain) Exec() error {
 	defer func() { a.executing = false }()
 
 	for _, f := range a.funcs {
+		if f.u != nil {
+			a.undo = append(a.undo, f.u)
+			continue
+		}
 		if f.f == nil {
 			if f.s != "" {
 				a.log.Println(f.s, "...")
-				a.lastStage = f.s
+				a.startStage(f.s)
 			}
 			continue
 		}
@@ -128,6 +160,7 @@ func (a *ActiveCommandChain) Exec() error {
 
 		// warning
 		if _, ok := err.(errNonFatal); ok {
+			a.emit(Event{Type: EventWarning, Stage: a.lastStage, Error: err.Error()})
 			if a.lastStage == "" {
 				a.log.Warnln(err)
 			} else {
@@ -137,14 +170,77 @@ func (a *ActiveCommandChain) Exec() error {
 		}
 
 		// error
+		a.endStage(err)
+		if a.rollback != nil && a.rollback.Disabled {
+			a.undo = nil
+		} else {
+			a.runUndo()
+		}
 		if a.lastStage == "" {
 			return err
 		}
 		return fmt.Errorf("error at '%s': %w", a.lastStage, err)
 	}
+
+	a.endStage(nil)
+
+	// the changes may need to be reverted by the caller
+	if a.rollback != nil {
+		for _, u := range a.undo {
+			a.rollback.Add(u)
+		}
+	}
+	a.undo = nil
+
 	return nil
 }
 
+// runUndo runs the undo actions in reverse order.
+func (a *ActiveCommandChain) runUndo() {
+	for i := len(a.undo) - 1; i >= 0; i-- {
+		if err := a.undo[i](); err != nil {
+			a.log.Warnln(fmt.Errorf("error reverting changes: %w", err))
+		}
+	}
+	a.undo = nil
+}
+
+// startStage ends the stage in progress (if any) and starts a new one.
+func (a *ActiveCommandChain) startStage(s string) {
+	a.endStage(nil)
+	a.lastStage = s
+	if a.quiet {
+		return
+	}
+	stage := StartStage(a.name, s)
+	a.stage = &stage
+}
+
+// endStage ends the stage in progress (if any).
+// A failure event is emitted instead if err is not nil.
+func (a *ActiveCommandChain) endStage(err error) {
+	if a.stage == nil {
+		if err != nil {
+			a.emit(Event{Type: EventFailure, Error: err.Error()})
+		}
+		return
+	}
+	_ = a.stage.End(err)
+	a.stage = nil
+}
+
+// emit emits the event in the context of the chain.
+func (a *ActiveCommandChain) emit(e Event) {
+	if a.quiet {
+		return
+	}
+	e.Context = a.name
+	if e.Stage == "" {
+		e.Stage = a.lastStage
+	}
+	Emit(e)
+}
+
 // Retry retries `f` up to `count` times at interval.
 // If after `count` attempts there is an error, the command chain is terminated with the final error.
 // retryCount starts from 1.
@@ -152,6 +248,7 @@ func (a *ActiveCommandChain) Retry(stage string, interval time.Duration, count i
 	a.Add(func() (err error) {
 		var i int
 		for err = f(i + 1); i < count && err != nil; i, err = i+1, f(i+1) {
+			a.emit(Event{Type: EventRetry, Stage: stage, Attempt: i + 1, Error: err.Error()})
 			if stage != "" {
 				a.log.Println(stage, "...")
 			}
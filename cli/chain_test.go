@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestActiveCommandChain_Undo(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         bool
+		disabled     bool
+		wantUndo     []string
+		wantRollback []string
+	}{
+		{name: "failure", fail: true, wantUndo: []string{"second", "first"}},
+		{name: "success", fail: false, wantRollback: []string{"second", "first"}},
+		{name: "failure with rollback disabled", fail: true, disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			undo := func(s string) func() error {
+				return func() error { got = append(got, s); return nil }
+			}
+
+			ctx, rollback := WithRollback(context.Background())
+			rollback.Disabled = tt.disabled
+			a := New("test").Init(ctx)
+			a.Add(func() error { return nil })
+			a.Undo(undo("first"))
+			a.Add(func() error { return nil })
+			a.Undo(undo("second"))
+			a.Add(func() error {
+				if tt.fail {
+					return errors.New("failed")
+				}
+				return nil
+			})
+			// not reached on failure
+			a.Undo(undo("third"))
+
+			if err := a.Exec(); (err != nil) != tt.fail {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.fail)
+			}
+			if !reflect.DeepEqual(got, tt.wantUndo) {
+				t.Errorf("undo = %v, want %v", got, tt.wantUndo)
+			}
+
+			got = nil
+			if err := rollback.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if tt.fail {
+				// undo actions already run or discarded by the chain
+				if got != nil {
+					t.Errorf("rollback = %v, want none", got)
+				}
+				return
+			}
+			want := append([]string{"third"}, tt.wantRollback...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("rollback = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRollbackStopsVM(t *testing.T) {
+	if RollbackStopsVM(context.Background()) {
+		t.Errorf("RollbackStopsVM() = true without rollback")
+	}
+	ctx, rollback := WithRollback(context.Background())
+	if RollbackStopsVM(ctx) {
+		t.Errorf("RollbackStopsVM() = true for restore")
+	}
+	rollback.StopVM = true
+	if !RollbackStopsVM(ctx) {
+		t.Errorf("RollbackStopsVM() = false for stop")
+	}
+}
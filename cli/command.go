@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
@@ -15,8 +16,18 @@ var runner commandRunner = &defaultCommandRunner{}
 var Settings = struct {
 	// Verbose toggles verbose output for commands.
 	Verbose bool
+	// Stdout is the standard output of commands, os.Stdout if not set.
+	Stdout io.Writer
 }{}
 
+// Stdout returns the standard output of commands, see Settings.Stdout.
+func Stdout() io.Writer {
+	if Settings.Stdout != nil {
+		return Settings.Stdout
+	}
+	return os.Stdout
+}
+
 // Command creates a new command.
 func Command(command string, args ...string) *exec.Cmd { return runner.Command(command, args...) }
 
@@ -36,7 +47,7 @@ type defaultCommandRunner struct{}
 
 func (d defaultCommandRunner) Command(command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = Stdout()
 	cmd.Stderr = os.Stderr
 
 	log.Trace("cmd ", quotedArgs(cmd.Args))
@@ -47,7 +58,7 @@ func (d defaultCommandRunner) Command(command string, args ...string) *exec.Cmd
 func (d defaultCommandRunner) CommandInteractive(command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = Stdout()
 	cmd.Stderr = os.Stderr
 
 	log.Trace("cmd int ", quotedArgs(cmd.Args))
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventType is the type of lifecycle event.
+type EventType string
+
+// Lifecycle event types.
+const (
+	EventStageStart EventType = "stage-start"
+	EventStageEnd   EventType = "stage-end"
+	EventRetry      EventType = "retry"
+	EventWarning    EventType = "warning"
+	EventFailure    EventType = "failure"
+)
+
+// Event is a lifecycle event emitted during command execution.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	Profile string    `json:"profile,omitempty"`
+	Context string    `json:"context"`
+	Stage   string    `json:"stage,omitempty"`
+	// Attempt is the attempt number for retry events.
+	Attempt int `json:"attempt,omitempty"`
+	// Duration is the duration of the stage in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// EventHandler handles lifecycle events.
+type EventHandler func(Event)
+
+var events struct {
+	handlers []*EventHandler
+	sync.Mutex
+}
+
+// OnEvent registers h to be called for every lifecycle event.
+// The returned function unregisters h.
+func OnEvent(h EventHandler) (remove func()) {
+	events.Lock()
+	defer events.Unlock()
+	handler := &h
+	events.handlers = append(events.handlers, handler)
+
+	return func() {
+		events.Lock()
+		defer events.Unlock()
+		events.handlers = slices.DeleteFunc(events.handlers, func(v *EventHandler) bool { return v == handler })
+	}
+}
+
+// Emit sends the event to the registered handlers.
+func Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	events.Lock()
+	defer events.Unlock()
+	for _, h := range events.handlers {
+		(*h)(e)
+	}
+}
+
+// EmitWarning emits a warning event for a non-fatal error.
+func EmitWarning(context string, err error) {
+	Emit(Event{Type: EventWarning, Context: context, Error: err.Error()})
+}
+
+// Stage is a stage in progress.
+type Stage struct {
+	context string
+	name    string
+	start   time.Time
+}
+
+// StartStage emits the start event for a stage and returns the stage.
+// The stage must be terminated with End.
+func StartStage(context, name string) Stage {
+	s := Stage{context: context, name: name, start: time.Now()}
+	Emit(Event{Type: EventStageStart, Context: context, Stage: name, Time: s.start})
+	return s
+}
+
+// End emits the end event for the stage, or the failure event if err is not nil.
+// err is returned as is for convenience.
+func (s Stage) End(err error) error {
+	e := Event{
+		Type:     EventStageEnd,
+		Context:  s.context,
+		Stage:    s.name,
+		Duration: time.Since(s.start).Milliseconds(),
+	}
+	if err != nil {
+		e.Type = EventFailure
+		e.Error = err.Error()
+	}
+	Emit(e)
+	return err
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestActiveCommandChain_Events(t *testing.T) {
+	var got []EventType
+	t.Cleanup(OnEvent(func(e Event) {
+		if e.Context == "test" {
+			got = append(got, e.Type)
+		}
+	}))
+
+	a := New("test").Init(context.Background())
+	a.Stage("first")
+	a.Add(func() error { return ErrNonFatal(errors.New("warning")) })
+	a.Stage("second")
+	attempts := 0
+	a.Retry("", time.Millisecond, 1, func(int) error {
+		if attempts++; attempts == 1 {
+			return errors.New("retry")
+		}
+		return nil
+	})
+	a.Stage("third")
+	a.Add(func() error { return errors.New("failure") })
+
+	if err := a.Exec(); err == nil {
+		t.Fatal("Exec() error = nil, want error")
+	}
+
+	want := []EventType{
+		EventStageStart, EventWarning, EventStageEnd,
+		EventStageStart, EventRetry, EventStageEnd,
+		EventStageStart, EventFailure,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
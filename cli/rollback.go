@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ctxKeyRollback = struct{ key string }{key: "rollback"}
+
+// Rollback holds the undo actions to revert the changes of multiple command chains.
+type Rollback struct {
+	// StopVM is set if the VM is stopped after the undo actions are run.
+	StopVM bool
+	// Disabled is set if the changes are kept on failure for inspection,
+	// the undo actions are then not run by the failed command chains either.
+	Disabled bool
+
+	undo []func() error
+	sync.Mutex
+}
+
+// RollbackStopsVM returns if the rollback in ctx (if any) stops the VM.
+// Changes to the config of the VM can only be reverted if the VM is stopped,
+// the files would otherwise not match the running VM.
+func RollbackStopsVM(ctx context.Context) bool {
+	r, _ := ctx.Value(ctxKeyRollback).(*Rollback)
+	return r != nil && r.StopVM
+}
+
+// WithRollback returns a copy of ctx with a new rollback.
+// Command chains initiated with the returned context hand over
+// the undo actions to the rollback on success.
+func WithRollback(ctx context.Context) (context.Context, *Rollback) {
+	r := &Rollback{}
+	return context.WithValue(ctx, ctxKeyRollback, r), r
+}
+
+// Add adds an undo action to the rollback.
+func (r *Rollback) Add(f func() error) {
+	r.Lock()
+	defer r.Unlock()
+	r.undo = append(r.undo, f)
+}
+
+// Run runs the undo actions in the reverse order they were added.
+// All undo actions are run, the errors (if any) are returned combined.
+func (r *Rollback) Run() error {
+	r.Lock()
+	undo := r.undo
+	r.undo = nil
+	r.Unlock()
+
+	var errs []error
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
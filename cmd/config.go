@@ -0,0 +1,398 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "manage the configuration",
+	Long:  `Manage the Colima configuration.`,
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "print the JSON Schema of the configuration",
+	Long: `Print the JSON Schema of the configuration file.
+
+The schema can be used by editors for validation and autocompletion of colima.yaml.
+e.g. with the YAML language server, add the following line to the top of the file.
+
+  # yaml-language-server: $schema=/path/to/colima-schema.json
+`,
+	Example: "  colima config schema > colima-schema.json",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := configmanager.ConfigSchema()
+		if err != nil {
+			return fmt.Errorf("error generating schema: %w", err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	},
+}
+
+// configExplainCmd represents the config explain command
+var configExplainCmd = &cobra.Command{
+	Use:   "explain <key>",
+	Short: "show which configuration layer sets a value",
+	Long: `Show which configuration layer sets the value of a key.
+
+The configuration is combined from the following layers, later layers take precedence.
+  default    built-in defaults
+  template   the template, see 'colima template'
+  extends    the configs extended by the profile config with 'extends'
+  profile    the config file of the profile
+  project    ` + configmanager.ProjectFileName + ` in the current directory or its closest parent directory
+  flag       the flags of 'colima start'
+
+Keys are separated by dots e.g. network.address.
+`,
+	Example: "  colima config explain cpu\n" +
+		"  colima config explain network.dnsHosts\n" +
+		"  colima config explain kubernetes.version --profile work",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		schema, err := configmanager.ConfigSchema()
+		if err != nil {
+			return fmt.Errorf("error generating schema: %w", err)
+		}
+		if !schemaHasKey(schema, key) {
+			return fmt.Errorf("unknown config key: '%s'", key)
+		}
+
+		defaults, err := configmanager.DefaultLayer()
+		if err != nil {
+			return err
+		}
+		layers, err := configLayers(true)
+		if err != nil {
+			return err
+		}
+		layers = append(configmanager.Layers{defaults}, layers...)
+
+		values := layers.Lookup(key)
+		if len(values) == 0 {
+			fmt.Printf("%s is not set\n", key)
+		} else {
+			effective := values[len(values)-1]
+			fmt.Printf("%s: %s (%s)\n", key, explainValue(effective.Value), effective.Layer.Name)
+		}
+		if flag, ok := configFlags[key]; ok {
+			fmt.Printf("can be overridden with 'colima start --%s'\n", flag)
+		}
+		fmt.Println()
+
+		t := tabwriter.NewWriter(os.Stdout, 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(t, "LAYER\tVALUE\tFILE")
+		for _, v := range values {
+			file := v.Layer.File
+			if file == "" {
+				file = "-"
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\n", v.Layer.Name, explainValue(v.Value), file)
+		}
+		return t.Flush()
+	},
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "print the configuration",
+	Long: `Print the config file of the profile, or the template with --template.
+
+With --resolved, the effective configuration is printed instead. It is combined from
+the built-in defaults, the template, the configs extended by the profile with 'extends',
+the profile config and the project config, see 'colima config explain'.
+`,
+	Example: "  colima config show\n" +
+		"  colima config show --resolved\n" +
+		"  colima config show --resolved --profile work",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !configCmdArgs.resolved {
+			file := configEditFile()
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("config file '%s' not found", file)
+			}
+			fmt.Print(string(b))
+			return nil
+		}
+
+		defaults, err := configmanager.DefaultLayer()
+		if err != nil {
+			return err
+		}
+		layers, err := configLayers(true)
+		if err != nil {
+			return err
+		}
+		c, err := append(configmanager.Layers{defaults}, layers...).Config()
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("error encoding config: %w", err)
+		}
+		return enc.Close()
+	},
+}
+
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "upgrade the configuration to the current version",
+	Long: `Upgrade the configuration file to the current version of the config format.
+
+Config files of older versions are upgraded when loaded, the file is only
+updated by this command. With --check, the changes are reported without updating
+the file and the command fails if the file is not up to date.
+`,
+	Example: "  colima config migrate\n" +
+		"  colima config migrate --check\n" +
+		"  colima config migrate --template",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := configEditFile()
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("config file '%s' not found", file)
+		}
+
+		changes, err := configmanager.MigrateFile(file, !configCmdArgs.check)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Printf("%s is up to date (version %d)\n", file, configmanager.CurrentVersion)
+			return nil
+		}
+
+		if configCmdArgs.check {
+			fmt.Printf("%s would be migrated to version %d:\n", file, configmanager.CurrentVersion)
+		} else {
+			fmt.Printf("%s migrated to version %d:\n", file, configmanager.CurrentVersion)
+		}
+		for _, change := range changes {
+			fmt.Println("  - " + change)
+		}
+		if configCmdArgs.check {
+			return fmt.Errorf("config file is not up to date, run 'colima config migrate' to update it")
+		}
+		return nil
+	},
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "print the value of a configuration key",
+	Long: `Print the value of a key in the config file of the profile, or the template with --template.
+
+Keys are separated by dots e.g. network.address, list items are referenced by index e.g. mounts[0].location.
+The value in the file is printed, use 'colima config explain' for the value in use.
+`,
+	Example: "  colima config get cpu\n" +
+		"  colima config get kubernetes.version\n" +
+		"  colima config get mounts[0].location --template",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		node, err := configmanager.GetValue(configEditFile(), args[0])
+		if err != nil {
+			return err
+		}
+		if node.Kind == yaml.ScalarNode {
+			fmt.Println(node.Value)
+			return nil
+		}
+		node.HeadComment, node.LineComment, node.FootComment = "", "", ""
+		node.Style = 0
+		b, err := yaml.Marshal(node)
+		if err != nil {
+			return fmt.Errorf("error encoding value: %w", err)
+		}
+		fmt.Print(string(b))
+		return nil
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "set the value of a configuration key",
+	Long: `Set the value of a key in the config file of the profile, or the template with --template.
+Comments and the order of keys in the file are preserved.
+
+Keys are separated by dots e.g. network.address, list items are referenced by index e.g. mounts[0].location
+and [+] appends to a list. The keys of env and network.dnsHosts may contain dots.
+The value is parsed as YAML e.g. 4, true, "quoted string", [a, b] or {key: value}.
+
+The change takes effect on the next start, or run 'colima start --edit' to apply it to a running instance.
+`,
+	Example: "  colima config set cpu 4\n" +
+		"  colima config set kubernetes.version v1.33.4+k3s1\n" +
+		"  colima config set network.dnsHosts.host.example.com 192.168.5.2\n" +
+		"  colima config set docker.insecure-registries[+] registry.local:5000\n" +
+		"  colima config set -- kubernetes.k3sArgs[+] --disable=servicelb\n" +
+		"  colima config set env.GOPROXY direct --template",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := configEditFile()
+
+		// a new template starts from the default template to retain its documentation
+		if _, err := os.Stat(file); err != nil && configCmdArgs.template {
+			body, err := templateFileOrDefault()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return fmt.Errorf("error creating template directory: %w", err)
+			}
+			if err := os.WriteFile(file, []byte(body), 0644); err != nil {
+				return fmt.Errorf("error saving template: %w", err)
+			}
+		}
+
+		return configmanager.SetValue(file, args[0], args[1])
+	},
+}
+
+// configUnsetCmd represents the config unset command
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "remove a configuration key",
+	Long: `Remove a key from the config file of the profile, or the template with --template.
+Comments and the order of the other keys in the file are preserved.
+
+The value of a removed key is taken from the template or the built-in defaults.
+`,
+	Example: "  colima config unset network.dnsHosts.host.example.com\n" +
+		"  colima config unset docker.insecure-registries[0]",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return configmanager.UnsetValue(configEditFile(), args[0])
+	},
+}
+
+// configEditFile returns the config file to read and edit.
+func configEditFile() string {
+	if configCmdArgs.template {
+		return templateFile()
+	}
+	return config.CurrentProfile().File()
+}
+
+var configCmdArgs struct {
+	check    bool
+	template bool
+	resolved bool
+}
+
+// configFlags maps config keys to their flags of the start command.
+var configFlags = map[string]string{
+	"cpu":                    "cpus",
+	"cpuType":                "cpu-type",
+	"memory":                 "memory",
+	"disk":                   "disk",
+	"rootDisk":               "root-disk",
+	"arch":                   "arch",
+	"runtime":                "runtime",
+	"modelRunner":            "model-runner",
+	"hostname":               "hostname",
+	"autoActivate":           "activate",
+	"vmType":                 "vm-type",
+	"rosetta":                "vz-rosetta",
+	"binfmt":                 "binfmt",
+	"nestedVirtualization":   "nested-virtualization",
+	"portForwarder":          "port-forwarder",
+	"diskImage":              "disk-image",
+	"diskImageMirror":        "disk-image-mirror",
+	"forceDiskImage":         "force-disk-image",
+	"mounts":                 "mount",
+	"mountType":              "mount-type",
+	"mountInotify":           "mount-inotify",
+	"forwardAgent":           "ssh-agent",
+	"sshConfig":              "ssh-config",
+	"sshPort":                "ssh-port",
+	"env":                    "env",
+	"kubernetes.enabled":     "kubernetes",
+	"kubernetes.version":     "kubernetes-version",
+	"kubernetes.k3sArgs":     "k3s-arg",
+	"kubernetes.port":        "k3s-listen-port",
+	"network.address":        "network-address",
+	"network.mode":           "network-mode",
+	"network.interface":      "network-interface",
+	"network.preferredRoute": "network-preferred-route",
+	"network.hostAddresses":  "network-host-addresses",
+	"network.dns":            "dns",
+	"network.dnsHosts":       "dns-host",
+	"network.gatewayAddress": "gateway-address",
+}
+
+// schemaHasKey returns if the dotted key is a property of the schema.
+func schemaHasKey(s *configmanager.Schema, key string) bool {
+	for _, k := range strings.Split(key, ".") {
+		if !slices.Contains(s.Type, "object") {
+			return false
+		}
+		if s.Properties == nil {
+			// keys of maps are arbitrary
+			return s.AdditionalProperties != false
+		}
+		p, ok := s.Properties[k]
+		if !ok {
+			return false
+		}
+		s = p
+	}
+	return true
+}
+
+func explainValue(v any) string {
+	switch v.(type) {
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func init() {
+	root.Cmd().AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configExplainCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configShowCmd)
+
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+
+	configMigrateCmd.Flags().BoolVar(&configCmdArgs.check, "check", false, "report the changes without updating the file")
+	configShowCmd.Flags().BoolVar(&configCmdArgs.resolved, "resolved", false, "print the effective configuration")
+	for _, cmd := range []*cobra.Command{configShowCmd, configMigrateCmd, configGetCmd, configSetCmd, configUnsetCmd} {
+		cmd.Flags().BoolVar(&configCmdArgs.template, "template", false, "use the template instead of the profile config")
+	}
+}
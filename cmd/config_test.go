@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/abiosoft/colima/config/configmanager"
+)
+
+func TestConfigFlags(t *testing.T) {
+	schema, err := configmanager.ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flags that are only available on some macOS versions and hardware
+	platformFlags := map[string]bool{
+		"network-address": true, "network-mode": true, "network-interface": true, "network-preferred-route": true,
+		"vm-type": true, "vz-rosetta": true, "model-runner": true, "nested-virtualization": true,
+	}
+
+	for key, flag := range configFlags {
+		if !schemaHasKey(schema, key) {
+			t.Errorf("unknown config key: %s", key)
+		}
+		if startCmd.Flags().Lookup(flag) == nil && !platformFlags[flag] {
+			t.Errorf("unknown start flag for %s: %s", key, flag)
+		}
+	}
+}
+
+func Test_schemaHasKey(t *testing.T) {
+	schema, err := configmanager.ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "cpu", want: true},
+		{key: "network.address", want: true},
+		{key: "docker.insecure-registries", want: true},
+		{key: "env.KEY", want: true},
+		{key: "cpus", want: false},
+		{key: "cpu.count", want: false},
+		{key: "network.adress", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := schemaHasKey(schema, tt.key); got != tt.want {
+				t.Errorf("schemaHasKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/abiosoft/colima/cmd/root"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/daemon/process/autostop"
 	"github.com/abiosoft/colima/daemon/process/inotify"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/environment/host"
@@ -45,6 +46,17 @@ var startCmd = &cobra.Command{
 			ctx = context.WithValue(ctx, inotify.CtxKeyArgs(), args)
 		}
 
+		if daemonArgs.autostop.enabled {
+			processes = append(processes, autostop.New())
+			args := autostop.Args{
+				GuestActions: lima.New(host.New()),
+				Runtime:      daemonArgs.autostop.runtime,
+				Kubernetes:   daemonArgs.autostop.kubernetes,
+				Idle:         time.Duration(daemonArgs.autostop.idleMinutes) * time.Minute,
+			}
+			ctx = context.WithValue(ctx, autostop.CtxKeyArgs(), args)
+		}
+
 		return start(ctx, processes)
 	},
 }
@@ -89,6 +101,12 @@ var daemonArgs struct {
 		dirs    []string
 		runtime string
 	}
+	autostop struct {
+		enabled     bool
+		idleMinutes int
+		runtime     string
+		kubernetes  bool
+	}
 
 	verbose bool
 }
@@ -106,4 +124,8 @@ func init() {
 	startCmd.Flags().BoolVar(&daemonArgs.inotify.enabled, "inotify", false, "start inotify")
 	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.dirs, "inotify-dir", nil, "set inotify directories")
 	startCmd.Flags().StringVar(&daemonArgs.inotify.runtime, "inotify-runtime", "docker", "set runtime")
+	startCmd.Flags().BoolVar(&daemonArgs.autostop.enabled, "autostop", false, "start autostop")
+	startCmd.Flags().IntVar(&daemonArgs.autostop.idleMinutes, "autostop-idle", 0, "idle minutes before the VM is stopped")
+	startCmd.Flags().StringVar(&daemonArgs.autostop.runtime, "autostop-runtime", "docker", "set runtime")
+	startCmd.Flags().BoolVar(&daemonArgs.autostop.kubernetes, "autostop-kubernetes", false, "check kubernetes pods")
 }
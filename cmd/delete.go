@@ -19,6 +19,9 @@ var deleteCmd = &cobra.Command{
 Use with caution. This deletes everything and a startup afterwards is like the
 initial startup of Colima.`,
 	Args: cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupOutput(cmd.OutOrStdout(), cmd.ErrOrStderr())
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return newApp().Delete(deleteCmdArgs.data, deleteCmdArgs.force)
 	},
@@ -26,6 +29,8 @@ initial startup of Colima.`,
 
 func init() {
 	root.Cmd().AddCommand(deleteCmd)
+	addOutputFlag(deleteCmd)
+	addLockFlags(deleteCmd.Flags())
 
 	deleteCmd.Flags().BoolVarP(&deleteCmdArgs.force, "force", "f", false, "do not prompt for yes/no")
 	deleteCmd.Flags().BoolVarP(&deleteCmdArgs.data, "data", "d", false, "delete container runtime data")
@@ -0,0 +1,531 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/store"
+	"github.com/abiosoft/colima/util/fsutil"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// diskCmd represents the disk command
+var diskCmd = &cobra.Command{
+	Use:   "disk",
+	Short: "manage disks",
+	Long: `Manage the disks of the VM.
+
+The runtime disk holds the container data of the profile e.g. /var/lib/docker,
+it is retained across VM deletions unless deleted with 'colima delete --data'.
+The data disks of the 'disks' config are always retained.`,
+}
+
+// diskSnapshotCmd represents the disk snapshot command
+var diskSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "manage snapshots of the runtime disk",
+	Long: `Manage snapshots of the runtime disk.
+
+Snapshots capture the container data for rolling back e.g. after a failed migration.
+qcow2 disks are snapshotted within the disk image, other formats are copied,
+as a clone on filesystems that support it.
+
+Snapshots are created, restored and deleted while the VM is stopped.
+They are deleted along with the runtime disk.`,
+}
+
+var diskSnapshotCmdArgs struct {
+	force bool
+	json  bool
+}
+
+// diskSnapshotCreateCmd represents the disk snapshot create command
+var diskSnapshotCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "create a snapshot of the runtime disk",
+	Long: `Create a snapshot of the runtime disk of the current container runtime.
+
+The name defaults to the current time e.g. 20240102-150405.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := time.Now().Format("20060102-150405")
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if !snapshotName.MatchString(name) {
+			return fmt.Errorf("invalid snapshot name '%s', only letters, digits, '.', '_' and '-' are allowed", name)
+		}
+
+		s, _ := store.Load()
+		if _, ok := s.DiskSnapshot(name); ok {
+			return fmt.Errorf("disk snapshot '%s' already exists", name)
+		}
+		runtime := instanceRuntime()
+		disk := limautil.RuntimeDiskName(s, runtime)
+		if err := assertDiskStopped(disk, "create"); err != nil {
+			return err
+		}
+
+		logrus.Infof("creating disk snapshot '%s' ...", name)
+		snapshot, err := limautil.CreateDiskSnapshot(disk, name)
+		if err != nil {
+			return err
+		}
+		snapshot.Runtime = runtime
+
+		return store.Set(func(s *store.Store) {
+			s.DiskSnapshots = append(s.DiskSnapshots, snapshot)
+		})
+	},
+}
+
+// diskSnapshotListCmd represents the disk snapshot list command
+var diskSnapshotListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list snapshots of the runtime disk",
+	Long:    `List snapshots of the runtime disk, oldest first.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, _ := store.Load()
+
+		if diskSnapshotCmdArgs.json {
+			// an entry per line, as 'colima list'
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			for _, snapshot := range s.DiskSnapshots {
+				if err := encoder.Encode(snapshot); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(s.DiskSnapshots) == 0 {
+			logrus.Warnf("No disk snapshots found for %s.", config.CurrentProfile().DisplayName)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tTYPE\tSIZE\tRUNTIME\tCREATED")
+		for _, snapshot := range s.DiskSnapshots {
+			runtime := snapshot.Runtime
+			if runtime == "" {
+				runtime = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				snapshot.Name,
+				snapshot.Type,
+				units.BytesSize(float64(snapshot.Size)),
+				runtime,
+				snapshot.Created.Local().Format(time.DateTime),
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// diskSnapshotRestoreCmd represents the disk snapshot restore command
+var diskSnapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "restore the runtime disk to a snapshot",
+	Long: `Restore the runtime disk to a snapshot.
+
+The disk of the container runtime of the snapshot is restored.
+The changes to the container data since the snapshot are discarded.
+The snapshot is retained and can be restored again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshot, err := diskSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		s, _ := store.Load()
+		disk := limautil.RuntimeDiskName(s, snapshot.Runtime)
+		if err := assertDiskStopped(disk, "restore"); err != nil {
+			return err
+		}
+
+		if !diskSnapshotCmdArgs.force {
+			msg := fmt.Sprintf("changes to the container data since '%s' will be lost, are you sure", snapshot.Name)
+			if y := cli.Prompt(msg); !y {
+				return nil
+			}
+		}
+
+		logrus.Infof("restoring disk snapshot '%s' ...", snapshot.Name)
+		return limautil.RestoreDiskSnapshot(disk, snapshot)
+	},
+}
+
+// diskSnapshotDeleteCmd represents the disk snapshot delete command
+var diskSnapshotDeleteCmd = &cobra.Command{
+	Use:     "delete <name>...",
+	Aliases: []string{"rm"},
+	Short:   "delete snapshots of the runtime disk",
+	Long:    `Delete snapshots of the runtime disk.`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var snapshots []store.DiskSnapshot
+		for _, name := range args {
+			snapshot, err := diskSnapshot(name)
+			if err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		s, _ := store.Load()
+		for _, snapshot := range snapshots {
+			if err := assertDiskStopped(limautil.RuntimeDiskName(s, snapshot.Runtime), "delete"); err != nil {
+				return err
+			}
+		}
+
+		for _, snapshot := range snapshots {
+			logrus.Infof("deleting disk snapshot '%s' ...", snapshot.Name)
+			if err := limautil.DeleteDiskSnapshot(limautil.RuntimeDiskName(s, snapshot.Runtime), snapshot); err != nil {
+				return err
+			}
+			if err := store.Set(func(s *store.Store) {
+				s.DiskSnapshots = slices.DeleteFunc(s.DiskSnapshots, func(d store.DiskSnapshot) bool {
+					return d.Name == snapshot.Name
+				})
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// diskCompactCmd represents the disk compact command
+var diskCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "reclaim unused disk space on the host",
+	Long: `Reclaim the disk space on the host that is no longer used in the VM.
+
+Disk images grow on the host as data is written in the VM, but do not shrink when
+the data is deleted e.g. with 'docker system prune'. The free space of the root
+filesystem and the runtime disk is trimmed in the VM, the VM is stopped and the disk
+images are rewritten without the unused space. The VM is started afterwards if it was running.
+
+A stopped VM is not trimmed, only space previously trimmed in the VM is reclaimed.
+The runtime disks of all container runtimes are compacted, except disks with internal
+snapshots as they are not retained.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := limautil.Instance(); err != nil {
+			return err
+		}
+		app := newApp()
+
+		// held for stop, compaction and start
+		return withLock(func() error {
+			s, _ := store.Load()
+			hasDisk := limautil.HasRuntimeDisk(s, instanceRuntime())
+			running := app.Active()
+
+			if running {
+				logrus.Info("trimming free space ...")
+				paths := []string{"/"}
+				if hasDisk {
+					paths = append(paths, limautil.MountPoint())
+				}
+				if err := app.SSH(append([]string{"sudo", "fstrim", "-v"}, paths...)...); err != nil {
+					logrus.Warnln(fmt.Errorf("error trimming free space: %w", err))
+				}
+				if err := app.Stop(false); err != nil {
+					return err
+				}
+			} else {
+				logrus.Warnf("%s is not running, free space is not trimmed", config.CurrentProfile().DisplayName)
+			}
+
+			images := []string{limautil.ColimaDiffDisk(config.CurrentProfile().ID)}
+			for _, runtime := range slices.Sorted(maps.Keys(s.RuntimeDisks)) {
+				if slices.ContainsFunc(s.DiskSnapshots, func(d store.DiskSnapshot) bool {
+					return d.Runtime == runtime && d.Type == store.DiskSnapshotInternal
+				}) {
+					logrus.Warnf("runtime disk of %s has internal snapshots, skipping", runtime)
+					continue
+				}
+				name := s.RuntimeDisks[runtime].Name
+				if _, ok := limautil.Disk(name); ok {
+					images = append(images, limautil.DiskFile(name))
+				}
+			}
+
+			var reclaimed int64
+			for _, image := range images {
+				logrus.Infof("compacting %s ...", image)
+				before, after, err := limautil.CompactDiskImage(image)
+				if err != nil {
+					return err
+				}
+				logrus.Infof("%s: %s -> %s", image, units.BytesSize(float64(before)), units.BytesSize(float64(after)))
+				reclaimed += before - after
+			}
+			logrus.Infof("reclaimed %s", units.BytesSize(float64(max(reclaimed, 0))))
+
+			if !running {
+				return nil
+			}
+			conf, err := configmanager.Load()
+			if err != nil {
+				return err
+			}
+			return app.Start(conf, appStartOptions())
+		})
+	},
+}
+
+var diskListCmdArgs struct {
+	json bool
+}
+
+// diskListCmd represents the disk list command
+var diskListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list data disks",
+	Long: `List the data disks of the 'disks' config.
+
+The host usage is the space allocated on the host for the disk image.
+The usage in the VM is only shown while the VM is running.
+Disks removed from the config are retained and listed without a mount point.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		disks, err := limautil.DataDisks()
+		if err != nil {
+			return err
+		}
+
+		// the mount points of the current instance, otherwise of the config
+		conf, err := configmanager.LoadInstance()
+		if err != nil {
+			conf, _ = configmanager.Load()
+		}
+		mountPoints := map[string]string{}
+		for _, d := range conf.Disks {
+			mountPoints[limautil.DataDiskName(d.Name)] = d.MountPointOrDefault()
+		}
+
+		var usages map[string]limautil.FilesystemUsage
+		if i, err := limautil.Instance(); err == nil && i.Running() && len(mountPoints) > 0 {
+			usages, err = limautil.FilesystemUsages(slices.Collect(maps.Values(mountPoints))...)
+			if err != nil {
+				logrus.Warnln(err)
+			}
+		}
+
+		type diskInfo struct {
+			Name       string `json:"name"`
+			Size       int64  `json:"size"`
+			HostUsage  int64  `json:"host_usage"`
+			Used       *int64 `json:"used,omitempty"`
+			MountPoint string `json:"mount_point,omitempty"`
+		}
+		var list []diskInfo
+		for _, d := range disks {
+			info := diskInfo{
+				Name:       strings.TrimPrefix(d.Name, limautil.DataDiskName("")),
+				Size:       d.Size,
+				MountPoint: mountPoints[d.Name],
+			}
+			if size, err := fsutil.AllocatedSize(filepath.Join(d.Dir, "datadisk")); err == nil {
+				info.HostUsage = size
+			}
+			if u, ok := usages[info.MountPoint]; ok {
+				info.Used = &u.Used
+			}
+			list = append(list, info)
+		}
+
+		if diskListCmdArgs.json {
+			// an entry per line, as 'colima list'
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			for _, d := range list {
+				if err := encoder.Encode(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(list) == 0 {
+			logrus.Warnf("No data disks found for %s.", config.CurrentProfile().DisplayName)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tSIZE\tHOST USAGE\tUSED\tMOUNT POINT")
+		for _, d := range list {
+			used, mountPoint := "-", "-"
+			if d.Used != nil {
+				used = units.BytesSize(float64(*d.Used))
+			}
+			if d.MountPoint != "" {
+				mountPoint = d.MountPoint
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				d.Name,
+				units.BytesSize(float64(d.Size)),
+				units.BytesSize(float64(d.HostUsage)),
+				used,
+				mountPoint,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var diskUsageCmdArgs struct {
+	json bool
+}
+
+// diskUsageCmd represents the disk usage command
+var diskUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "show the disk usage",
+	Long: `Show the disk usage of the profile on the host and in the VM.
+
+The host usage of the disk images is the space allocated on the host, which is less than
+the size for sparse images. The usage in the VM of the root filesystem, the runtime disk
+and the container runtime directories e.g. /var/lib/docker is only shown while the VM is running,
+along with the usage reported by the container runtime e.g. 'docker system df'.`,
+	Example: "  colima disk usage\n" +
+		"  colima disk usage --json",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := limautil.Instance(); err != nil {
+			return err
+		}
+		usage, err := newApp().DiskUsage()
+		if err != nil {
+			return err
+		}
+
+		if diskUsageCmdArgs.json {
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(usage)
+		}
+
+		bytesSize := func(size int64) string { return units.BytesSize(float64(size)) }
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		var total int64
+		_, _ = fmt.Fprintln(w, "DISK\tSIZE\tHOST USAGE\tFILE")
+		for _, d := range usage.Host {
+			total += d.Allocated
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, bytesSize(d.Size), bytesSize(d.Allocated), d.File)
+		}
+		_, _ = fmt.Fprintf(w, "total\t\t%s\t\n", bytesSize(total))
+
+		if len(usage.Filesystems) > 0 {
+			_, _ = fmt.Fprintln(w)
+			_, _ = fmt.Fprintln(w, "FILESYSTEM\tSIZE\tUSED\tUSE%")
+			for _, f := range usage.Filesystems {
+				percent := "-"
+				if f.Size > 0 {
+					percent = fmt.Sprintf("%d%%", f.Used*100/f.Size)
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.MountPoint, bytesSize(f.Size), bytesSize(f.Used), percent)
+			}
+		}
+
+		if len(usage.Directories) > 0 {
+			_, _ = fmt.Fprintln(w)
+			_, _ = fmt.Fprintln(w, "DIRECTORY\tUSED")
+			for _, d := range usage.Directories {
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", d.Path, bytesSize(d.Used))
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if usage.Runtime == "" {
+			logrus.Warnf("%s is not running, only the host usage is shown", config.CurrentProfile().DisplayName)
+			return nil
+		}
+		if usage.RuntimeUsage != "" {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout())
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), strings.TrimSpace(usage.RuntimeUsage))
+		}
+		return nil
+	},
+}
+
+var snapshotName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// diskSnapshot returns the snapshot of the runtime disk with the name.
+func diskSnapshot(name string) (store.DiskSnapshot, error) {
+	s, _ := store.Load()
+	snapshot, ok := s.DiskSnapshot(name)
+	if !ok {
+		return snapshot, fmt.Errorf("disk snapshot '%s' not found, list snapshots with 'colima disk snapshot list'", name)
+	}
+	return snapshot, nil
+}
+
+// instanceRuntime returns the container runtime of the current instance,
+// or of the config if the instance has not been created.
+func instanceRuntime() string {
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		conf, _ = configmanager.Load()
+	}
+	return conf.Runtime
+}
+
+// assertDiskStopped asserts that the runtime disk exists and is not in use by the VM.
+func assertDiskStopped(disk string, action string) error {
+	profile := config.CurrentProfile()
+	if _, ok := limautil.Disk(disk); !ok {
+		return fmt.Errorf("%s has no runtime disk '%s'", profile.DisplayName, disk)
+	}
+	if i, err := limautil.Instance(); err == nil && i.Running() {
+		return fmt.Errorf("%s must be stopped to %s disk snapshots, stop with 'colima stop %s'", profile.DisplayName, action, profile.ShortName)
+	}
+	return nil
+}
+
+func init() {
+	root.Cmd().AddCommand(diskCmd)
+	diskCmd.AddCommand(diskSnapshotCmd)
+	diskCmd.AddCommand(diskCompactCmd)
+	diskCmd.AddCommand(diskListCmd)
+	diskCmd.AddCommand(diskUsageCmd)
+	diskSnapshotCmd.AddCommand(diskSnapshotCreateCmd)
+	diskSnapshotCmd.AddCommand(diskSnapshotListCmd)
+	diskSnapshotCmd.AddCommand(diskSnapshotRestoreCmd)
+	diskSnapshotCmd.AddCommand(diskSnapshotDeleteCmd)
+
+	diskListCmd.Flags().BoolVarP(&diskListCmdArgs.json, "json", "j", false, "print json output")
+	diskUsageCmd.Flags().BoolVarP(&diskUsageCmdArgs.json, "json", "j", false, "print json output")
+	diskSnapshotListCmd.Flags().BoolVarP(&diskSnapshotCmdArgs.json, "json", "j", false, "print json output")
+	diskSnapshotRestoreCmd.Flags().BoolVarP(&diskSnapshotCmdArgs.force, "force", "f", false, "do not prompt for yes/no")
+
+	addLockFlags(diskCompactCmd.Flags())
+
+	// snapshots are modified while the VM is stopped, a concurrent start must wait
+	addLockFlags(diskSnapshotCmd.PersistentFlags())
+	for _, cmd := range []*cobra.Command{diskSnapshotCreateCmd, diskSnapshotRestoreCmd, diskSnapshotDeleteCmd} {
+		runE := cmd.RunE
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return withLock(func() error { return runE(cmd, args) })
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var historyCmdArgs struct {
+	json  bool
+	limit int
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history [profile]",
+	Short: "show the lifecycle history",
+	Long: `Show the history of starts, stops, updates and deletions of a profile, oldest first.
+
+Each entry records the outcome, the duration, the slowest stage and the versions of
+Colima, the container runtime and Kubernetes. The duration of every stage is
+included in the json output.`,
+	Example: "  colima history\n" +
+		"  colima history work -n 5\n" +
+		"  colima history --json",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := store.History()
+		if err != nil {
+			return err
+		}
+		if historyCmdArgs.limit > 0 && len(entries) > historyCmdArgs.limit {
+			entries = entries[len(entries)-historyCmdArgs.limit:]
+		}
+
+		if historyCmdArgs.json {
+			// an entry per line, as 'colima list'
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			for _, e := range entries {
+				if err := encoder.Encode(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(entries) == 0 {
+			logrus.Warnf("No history found for %s.", config.CurrentProfile().DisplayName)
+			return nil
+		}
+
+		value := func(s string) string {
+			if s == "" {
+				return "-"
+			}
+			return s
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TIME\tCOMMAND\tOUTCOME\tDURATION\tSLOWEST STAGE\tRUNTIME\tKUBERNETES\tCOLIMA")
+		for _, e := range entries {
+			slowest := "-"
+			if s, ok := e.Slowest(); ok {
+				slowest = fmt.Sprintf("%s/%s (%s)", s.Context, s.Stage, historyDuration(s.Duration))
+			}
+			runtime := e.Runtime
+			if e.RuntimeVersion != "" {
+				runtime += " " + e.RuntimeVersion
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Time.Local().Format(time.DateTime),
+				e.Command,
+				e.Outcome,
+				historyDuration(e.Duration),
+				slowest,
+				value(runtime),
+				value(e.KubernetesVersion),
+				e.ColimaVersion,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// historyDuration returns the duration of milliseconds rounded to a tenth of a second e.g. 1m2.5s.
+func historyDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Second {
+		return d.String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func init() {
+	root.Cmd().AddCommand(historyCmd)
+
+	historyCmd.Flags().BoolVarP(&historyCmdArgs.json, "json", "j", false, "print json output")
+	historyCmd.Flags().IntVarP(&historyCmdArgs.limit, "limit", "n", 0, "show only the latest entries")
+}
@@ -134,4 +134,12 @@ func init() {
 	kubernetesCmd.AddCommand(kubernetesStopCmd)
 	kubernetesCmd.AddCommand(kubernetesDeleteCmd)
 	kubernetesCmd.AddCommand(kubernetesResetCmd)
+
+	addLockFlags(kubernetesCmd.PersistentFlags())
+	for _, cmd := range kubernetesCmd.Commands() {
+		runE := cmd.RunE
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return withLock(func() error { return runE(cmd, args) })
+		}
+	}
 }
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/bundle"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "share profiles",
+	Long:  `Export and import Colima profiles.`,
+}
+
+var profileCmdArgs struct {
+	output string
+	disks  bool
+	force  bool
+}
+
+// profileExportCmd represents the profile export command
+var profileExportCmd = &cobra.Command{
+	Use:   "export [profile]",
+	Short: "export a profile to a bundle",
+	Long: `Export a profile to a tar.gz bundle.
+
+The bundle contains the profile config, the per-profile containerd and buildkitd
+config overrides, the files referenced by provision scripts and the template.
+Secrets in the profile config and the template are replaced with references to
+environment variables, which must be set when the imported profile is started.
+Secrets in the containerd and buildkitd config e.g. registry credentials are emptied.
+The files referenced by provision scripts are exported as is.
+
+The VM disks are included with --disks, the VM must be stopped.
+`,
+	Example: "  colima profile export -o colima.tar.gz\n" +
+		"  colima profile export work -o work.tar.gz\n" +
+		"  colima profile export work -o work.tar.gz --disks",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := config.CurrentProfile()
+		if len(args) > 0 {
+			p = config.ProfileFromName(args[0])
+		}
+		output := profileCmdArgs.output
+		if output == "" {
+			output = p.ShortName + ".tar.gz"
+		}
+
+		if profileCmdArgs.disks {
+			if instances, err := limautil.Instances(p.ShortName); err == nil && len(instances) > 0 && instances[0].Running() {
+				return fmt.Errorf("%s is running, stop it with `colima stop %s` to export the disks", p.DisplayName, p.ShortName)
+			}
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("error creating bundle: %w", err)
+			}
+			defer func() { _ = f.Close() }()
+			w = f
+		}
+
+		m, err := bundle.Export(w, p.ShortName, p, bundle.ExportOptions{
+			Template: templateFile(),
+			Disks:    profileCmdArgs.disks,
+		})
+		if err != nil {
+			if output != "-" {
+				_ = os.Remove(output)
+			}
+			return err
+		}
+
+		for _, r := range m.Redacted {
+			if r.Variable == "" {
+				log.Warnf("%s redacted in %s, set it again after importing", r.Key, r.File)
+				continue
+			}
+			log.Warnf("%s redacted in %s, set with the environment variable %s", r.Key, r.File, r.Variable)
+		}
+		if output != "-" {
+			log.Printf("profile '%s' exported to %s", p.ShortName, output)
+		}
+		return nil
+	},
+}
+
+// profileImportCmd represents the profile import command
+var profileImportCmd = &cobra.Command{
+	Use:   "import <bundle> [profile]",
+	Short: "import a profile from a bundle",
+	Long: `Import a profile from a bundle created with 'colima profile export'.
+
+The profile is imported with the name in the bundle, unless specified.
+The template in the bundle is only imported if there is no template.
+`,
+	Example: "  colima profile import work.tar.gz\n" +
+		"  colima profile import work.tar.gz team",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[0]
+
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("error opening bundle: %w", err)
+		}
+		m, err := bundle.ReadManifest(f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+
+		name := m.Profile
+		if len(args) > 1 {
+			name = args[1]
+		}
+		p := config.ProfileFromName(name)
+
+		f, err = os.Open(file)
+		if err != nil {
+			return fmt.Errorf("error opening bundle: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		log.Printf("importing profile '%s'...", p.ShortName)
+		m, err = bundle.Import(f, p, bundle.ImportOptions{
+			Template: templateFile(),
+			Force:    profileCmdArgs.force,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range m.Redacted {
+			if r.Variable == "" {
+				log.Warnf("%s in %s is a secret and has been emptied, set it before starting", r.Key, r.File)
+				continue
+			}
+			log.Warnf("%s is a secret, set the environment variable %s before starting", r.Key, r.Variable)
+		}
+		log.Printf("profile '%s' imported", p.ShortName)
+		log.Printf("run `colima start %s` to start the profile", p.ShortName)
+		return nil
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(profileCmd)
+	profileCmd.AddCommand(profileExportCmd)
+	profileCmd.AddCommand(profileImportCmd)
+
+	profileExportCmd.Flags().StringVarP(&profileCmdArgs.output, "output", "o", "", "bundle file, '-' for stdout (default \"<profile>.tar.gz\")")
+	profileExportCmd.Flags().BoolVar(&profileCmdArgs.disks, "disks", false, "include the VM disks")
+	profileImportCmd.Flags().BoolVarP(&profileCmdArgs.force, "force", "f", false, "replace the config of an existing profile")
+}
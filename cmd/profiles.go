@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abiosoft/colima/app"
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/osutil"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// profileSelector returns the profile pattern if the command targets multiple profiles.
+// Multiple profiles are targeted with the --all flag or a profile containing glob characters.
+func profileSelector(all bool) (string, bool) {
+	if all {
+		return "*", true
+	}
+
+	profile := config.CurrentProfile().ShortName
+	if strings.ContainsAny(profile, "*?[") {
+		return profile, true
+	}
+	return "", false
+}
+
+// selectProfiles returns the names of the instances matching the pattern
+// and accepted by filter.
+func selectProfiles(pattern string, filter func(limautil.InstanceInfo) bool) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid profile pattern '%s': %w", pattern, err)
+	}
+
+	instances, err := limautil.Instances()
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []string
+	for _, i := range instances {
+		if ok, _ := path.Match(pattern, i.Name); ok && filter(i) {
+			profiles = append(profiles, i.Name)
+		}
+	}
+	return profiles, nil
+}
+
+// profileResult is the result of a lifecycle command for a profile.
+type profileResult struct {
+	Profile  string
+	Duration time.Duration
+	Error    error
+}
+
+// runForProfiles runs the lifecycle command for each of the profiles concurrently,
+// with at most parallel commands running at a time.
+// The lifecycle events of the commands are written to events if not nil,
+// the log output is written to logs prefixed with the profile. Both are written as they arrive.
+func runForProfiles(profiles []string, parallel int, events, logs io.Writer, args ...string) []profileResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]profileResult, len(profiles))
+	sem := make(chan struct{}, parallel)
+
+	var mu sync.Mutex // guards events and logs
+	var wg sync.WaitGroup
+	for i, profile := range profiles {
+		wg.Add(1)
+		go func(i int, profile string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = runForProfile(profile, func(line string) {
+				if events == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				_, _ = fmt.Fprintln(events, line)
+			}, func(line string) {
+				mu.Lock()
+				defer mu.Unlock()
+				_, _ = fmt.Fprintf(logs, "[%s] %s\n", profile, logMessage(line))
+			}, args...)
+		}(i, profile)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runForProfile runs the lifecycle command for the profile in a separate process,
+// reporting the outcome from its lifecycle events.
+// onEvent and onLog are called with each line of the lifecycle events and the log output as it arrives.
+//
+// The profile is process-wide state, read with config.CurrentProfile throughout the app
+// and the environments, and the commands of several profiles can therefore not run
+// concurrently in-process. A separate process per profile costs the parsing of its output,
+// in exchange the commands are isolated from each other as if run by hand.
+func runForProfile(profile string, onEvent, onLog func(string), args ...string) profileResult {
+	start := time.Now()
+
+	args = append(args, "--profile", profile, "--output", "json")
+	if !app.LockWait {
+		args = append(args, "--no-wait")
+	}
+	cmd := cli.Command(osutil.Executable(), args...)
+
+	var outcome profileOutcome
+	stdout := &lineWriter{fn: func(line string) {
+		if outcome.event(line) {
+			onEvent(line)
+		}
+	}}
+	stderr := &lineWriter{fn: func(line string) {
+		if outcome.log(line) {
+			onLog(line)
+		}
+	}}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logrus.Infof("%s %s ...", args[0], profile)
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	return outcome.result(profile, time.Since(start), err)
+}
+
+// profileOutcome is the outcome of the lifecycle command of a profile, read from its output.
+type profileOutcome struct {
+	duration time.Duration
+	failure  string
+	lastLog  string
+}
+
+// event records the lifecycle event in the line of the json output.
+// It returns false if the line is not a lifecycle event.
+func (o *profileOutcome) event(line string) bool {
+	var e cli.Event
+	if json.Unmarshal([]byte(line), &e) != nil {
+		return false
+	}
+
+	// events of the app, not the individual stages, report the outcome
+	if e.Context != config.AppName {
+		return true
+	}
+	switch e.Type {
+	case cli.EventStageEnd:
+		o.duration = time.Duration(e.Duration) * time.Millisecond
+	case cli.EventFailure:
+		o.failure = e.Error
+	}
+	return true
+}
+
+// log records the line of the log output.
+// It returns false if the line is blank.
+func (o *profileOutcome) log(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+	o.lastLog = logMessage(line)
+	return true
+}
+
+// result returns the result of the profile given the elapsed time and the error of the command.
+// The last log line is the error message if the command failed without a failure event.
+func (o profileOutcome) result(profile string, elapsed time.Duration, err error) profileResult {
+	result := profileResult{Profile: profile, Duration: o.duration}
+	if result.Duration == 0 {
+		result.Duration = elapsed
+	}
+
+	if err != nil {
+		failure := o.failure
+		if failure == "" {
+			failure = o.lastLog
+		}
+		result.Error = fmt.Errorf("%s: %w", failure, err)
+	}
+	return result
+}
+
+// lineWriter calls fn with each line written to it, without the line ending.
+type lineWriter struct {
+	buf []byte
+	fn  func(line string)
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.fn(strings.TrimSuffix(string(l.buf[:i]), "\r"))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush calls fn with the remaining incomplete line, if any.
+func (l *lineWriter) Flush() {
+	if len(l.buf) > 0 {
+		l.fn(string(l.buf))
+		l.buf = nil
+	}
+}
+
+// logLinePattern matches the level and message of a log line of a colima process without a terminal.
+var logLinePattern = regexp.MustCompile(`^time="[^"]*" level=(\w+) msg=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// logMessage returns the log line of a colima process in the format of the terminal output.
+func logMessage(line string) string {
+	m := logLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	msg := m[2]
+	if s, err := strconv.Unquote(msg); err == nil {
+		msg = s
+	}
+	return strings.ToUpper(m[1]) + " " + msg + line[len(m[0]):]
+}
+
+// printProfileResults prints the summary of the results as a table.
+func printProfileResults(w io.Writer, results []profileResult) error {
+	t := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(t, "PROFILE\tSTATUS\tDURATION\tERROR")
+
+	for _, r := range results {
+		status := "ok"
+		var errMsg string
+		if r.Error != nil {
+			status = "failed"
+			errMsg = r.Error.Error()
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n",
+			r.Profile,
+			status,
+			r.Duration.Round(time.Second),
+			errMsg,
+		)
+	}
+
+	return t.Flush()
+}
+
+// runProfiles runs the lifecycle command for the profiles and reports the results.
+func runProfiles(cmd *cobra.Command, profiles []string, parallel int, args ...string) error {
+	if len(profiles) == 0 {
+		logrus.Warnln("no matching profile found")
+		return nil
+	}
+
+	var results []profileResult
+	if lifecycleOutput == "json" {
+		results = runForProfiles(profiles, parallel, eventOutput, cmd.ErrOrStderr(), args...)
+	} else {
+		results = runForProfiles(profiles, parallel, nil, cmd.ErrOrStderr(), args...)
+		if err := printProfileResults(cmd.OutOrStdout(), results); err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Error != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d profile(s) failed", failed, len(results))
+	}
+	return nil
+}
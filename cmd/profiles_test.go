@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_lineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	for _, s := range []string{"first\nsec", "ond\r\n", "\nlast"} {
+		_, _ = w.Write([]byte(s))
+	}
+	if want := []string{"first", "second", ""}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines before flush = %q, want %q", lines, want)
+	}
+	w.Flush()
+	if want := []string{"first", "second", "", "last"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines after flush = %q, want %q", lines, want)
+	}
+}
+
+func Test_logMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: `time="2026-01-02T15:04:05Z" level=info msg="starting colima"`, want: "INFO starting colima"},
+		{line: `time="2026-01-02T15:04:05Z" level=warning msg=done`, want: "WARNING done"},
+		{line: `time="2026-01-02T15:04:05Z" level=fatal msg="error starting vm: \"exit 1\"" context=vm`, want: `FATAL error starting vm: "exit 1" context=vm`},
+		{line: "plain output", want: "plain output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := logMessage(tt.line); got != tt.want {
+				t.Errorf("logMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_profileOutcome(t *testing.T) {
+	exit := errors.New("exit status 1")
+	tests := []struct {
+		name     string
+		stdout   []string
+		stderr   []string
+		err      error
+		events   int
+		duration time.Duration
+		error    string
+	}{
+		{
+			name: "success",
+			stdout: []string{
+				`{"type":"stage-end","context":"vm","stage":"start","duration":500}`,
+				`{"type":"stage-end","context":"colima","stage":"start","duration":2000}`,
+			},
+			stderr:   []string{`time="2026-01-02T15:04:05Z" level=info msg=done`, " "},
+			events:   2,
+			duration: 2 * time.Second,
+		},
+		{
+			name: "failure event",
+			stdout: []string{
+				"not an event",
+				`{"type":"failure","context":"vm","error":"vm failed"}`,
+				`{"type":"failure","context":"colima","error":"error starting vm"}`,
+			},
+			stderr:   []string{`time="2026-01-02T15:04:05Z" level=fatal msg="error starting vm"`},
+			err:      exit,
+			events:   2,
+			duration: time.Minute,
+			error:    "error starting vm: exit status 1",
+		},
+		{
+			name:     "failure without event",
+			stderr:   []string{`time="2026-01-02T15:04:05Z" level=fatal msg="instance is locked"`, ""},
+			err:      exit,
+			duration: time.Minute,
+			error:    "FATAL instance is locked: exit status 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o profileOutcome
+			var events int
+			for _, line := range tt.stdout {
+				if o.event(line) {
+					events++
+				}
+			}
+			for _, line := range tt.stderr {
+				o.log(line)
+			}
+			if events != tt.events {
+				t.Errorf("events = %d, want %d", events, tt.events)
+			}
+
+			r := o.result("test", time.Minute, tt.err)
+			if r.Profile != "test" || r.Duration != tt.duration {
+				t.Errorf("result = %s %v, want test %v", r.Profile, r.Duration, tt.duration)
+			}
+			var got string
+			if r.Error != nil {
+				got = r.Error.Error()
+			}
+			if got != tt.error {
+				t.Errorf("error = %q, want %q", got, tt.error)
+			}
+		})
+	}
+}
@@ -30,24 +30,28 @@ should return it back to its previous state.`,
 
 		app := newApp()
 
-		if err := app.Stop(restartCmdArgs.force); err != nil {
-			return err
-		}
-
-		// delay a bit before starting
-		time.Sleep(time.Second * 3)
-
-		config, err := configmanager.Load()
-		if err != nil {
-			return err
-		}
-
-		return app.Start(config)
+		// held for both stop and start
+		return withLock(func() error {
+			if err := app.Stop(restartCmdArgs.force); err != nil {
+				return err
+			}
+
+			// delay a bit before starting
+			time.Sleep(time.Second * 3)
+
+			config, err := configmanager.Load()
+			if err != nil {
+				return err
+			}
+
+			return app.Start(config, appStartOptions())
+		})
 	},
 }
 
 func init() {
 	root.Cmd().AddCommand(restartCmd)
+	addLockFlags(restartCmd.Flags())
 
 	restartCmd.Flags().BoolVarP(&restartCmdArgs.force, "force", "f", false, "during restart, do stop without graceful shutdown")
 }
@@ -24,7 +24,7 @@ var rootCmd = &cobra.Command{
 		switch cmd.Name() {
 
 		// special case handling for commands directly interacting with the VM
-		// start, stop, restart, delete, status, version, update, ssh-config
+		// start, stop, restart, delete, status, version, update, ssh-config, history
 		case "start",
 			"stop",
 			"restart",
@@ -33,7 +33,8 @@ var rootCmd = &cobra.Command{
 			"list",
 			"version",
 			"update",
-			"ssh-config":
+			"ssh-config",
+			"history":
 
 			// if an arg is passed, assume it to be the profile (provided --profile is unset)
 			// i.e. colima start docker == colima start --profile=docker
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/abiosoft/colima/app"
@@ -21,8 +26,10 @@ import (
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/container/incus"
 	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/downloader"
+	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/abiosoft/colima/util/osutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -36,9 +43,17 @@ var startCmd = &cobra.Command{
 
 Colima can also be configured with a YAML file.
 Run 'colima template' to set the default configurations or 'colima start --edit' to customize before startup.
+
+A .colima.yaml file in the current directory (or its closest parent directory) is applied on top
+of the profile config without being saved to it, flags take precedence over both.
+Variables are not expanded in the project config.
+Run 'colima config explain <key>' to show where a value is set.
 `,
 	Example: "  colima start\n" +
 		"  colima start --edit\n" +
+		"  colima start --dry-run\n" +
+		"  colima start --all\n" +
+		"  colima start --profile 'ci-*'\n" +
 		"  colima start --foreground\n" +
 		"  colima start --runtime containerd\n" +
 		"  colima start --kubernetes\n" +
@@ -51,14 +66,28 @@ Run 'colima template' to set the default configurations or 'colima start --edit'
 		"  colima start --kubernetes --k3s-arg='\"--disable=coredns,servicelb,traefik,local-storage,metrics-server\"'",
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if pattern, ok := profileSelector(startCmdArgs.Flags.All); ok {
+			profiles, err := selectProfiles(pattern, func(i limautil.InstanceInfo) bool { return !i.Running() })
+			if err != nil {
+				return err
+			}
+			return runProfiles(cmd, profiles, startCmdArgs.Flags.Parallel, "start", "--rollback", startCmdArgs.Flags.Rollback)
+		}
+
 		app := newApp()
 		conf := startCmdArgs.Config
 
 		if !startCmdArgs.Flags.Edit {
 			if app.Active() {
+				if startCmdArgs.Flags.DryRun {
+					return planRunning(conf)
+				}
 				log.Warnln("already running, ignoring")
 				return nil
 			}
+			if startCmdArgs.Flags.DryRun {
+				return app.Plan(conf)
+			}
 			return start(app, conf)
 		}
 
@@ -68,41 +97,51 @@ Run 'colima template' to set the default configurations or 'colima start --edit'
 			return err
 		}
 
-		// validate config
-		if err := configmanager.ValidateConfig(conf); err != nil {
-			return fmt.Errorf("error in config file: %w", err)
-		}
-
 		if app.Active() {
-			if !cli.Prompt("colima is currently running, restart to apply changes") {
-				return nil
-			}
-			if err := app.Stop(false); err != nil {
-				return fmt.Errorf("error stopping :%w", err)
-			}
-			// pause before startup to prevent race condition
-			time.Sleep(time.Second * 3)
+			return applyChanges(app, conf)
 		}
 
 		return start(app, conf)
 	},
 	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupOutput(cmd.OutOrStdout(), cmd.ErrOrStderr()); err != nil {
+			return err
+		}
+
 		// validate Lima version
 		if err := core.LimaVersionSupported(); err != nil {
 			return fmt.Errorf("lima compatibility error: %w", err)
 		}
 
+		if !slices.Contains(app.RollbackModes(), startCmdArgs.Flags.Rollback) {
+			return fmt.Errorf("invalid rollback: '%s'", startCmdArgs.Flags.Rollback)
+		}
+
+		if startCmdArgs.Flags.DryRun && startCmdArgs.Flags.Edit {
+			return fmt.Errorf("--dry-run cannot be used with --edit")
+		}
+
+		// multiple profiles are started with their existing configs
+		if _, ok := profileSelector(startCmdArgs.Flags.All); ok {
+			if startCmdArgs.Flags.DryRun || startCmdArgs.Flags.Edit {
+				return fmt.Errorf("--dry-run and --edit cannot be used with multiple profiles")
+			}
+			return nil
+		}
+
 		// combine args and current config file(if any)
-		prepareConfig(cmd)
+		if err := prepareConfig(cmd); err != nil {
+			return err
+		}
 
 		// validate config
-		if err := configmanager.ValidateConfig(startCmdArgs.Config); err != nil {
+		if err := validateStartConfig(); err != nil {
 			return fmt.Errorf("error in config: %w", err)
 		}
 
 		// persist in preparation for application start
-		if startCmdArgs.Flags.SaveConfig {
-			if err := configmanager.Save(startCmdArgs.Config); err != nil {
+		if startCmdArgs.Flags.SaveConfig && !startCmdArgs.Flags.DryRun {
+			if err := configmanager.Save(startCmdArgs.profileConfig); err != nil {
 				return fmt.Errorf("error preparing config file: %w", err)
 			}
 		}
@@ -140,6 +179,9 @@ var (
 var startCmdArgs struct {
 	config.Config
 
+	// profileConfig is the config persisted for the profile, it excludes the project config.
+	profileConfig config.Config
+
 	Flags struct {
 		Mounts                  []string
 		LegacyKubernetes        bool // for backward compatibility
@@ -156,6 +198,10 @@ var startCmdArgs struct {
 		LegacyCPU               int // for backward compatibility
 		Template                bool
 		Downloader              string // downloader to use (native, curl)
+		DryRun                  bool
+		All                     bool
+		Parallel                int
+		Rollback                string
 	}
 }
 
@@ -183,6 +229,8 @@ func init() {
 	}
 
 	root.Cmd().AddCommand(startCmd)
+	addOutputFlag(startCmd)
+	addLockFlags(startCmd.Flags())
 	startCmd.Flags().StringVarP(&startCmdArgs.Runtime, "runtime", "r", docker.Name, "container runtime ("+runtimes+")")
 	startCmd.Flags().BoolVar(&startCmdArgs.Flags.ActivateRuntime, "activate", true, "set as active Docker/Kubernetes/Incus context on startup")
 	startCmd.Flags().IntVarP(&startCmdArgs.CPU, "cpus", "c", defaultCPU, "number of CPUs")
@@ -243,6 +291,10 @@ func init() {
 	startCmd.Flags().BoolVarP(&startCmdArgs.Flags.Edit, "edit", "e", false, "edit the configuration file before starting")
 	startCmd.Flags().StringVar(&startCmdArgs.Flags.Editor, "editor", "", `editor to use for edit e.g. vim, nano, code (default "$EDITOR" env var)`)
 	startCmd.Flags().BoolVar(&startCmdArgs.Flags.SaveConfig, "save-config", saveConfigDefault, "persist and overwrite config file with (newly) specified flags")
+	startCmd.Flags().BoolVar(&startCmdArgs.Flags.DryRun, "dry-run", false, "print the startup plan without starting")
+	startCmd.Flags().StringVar(&startCmdArgs.Flags.Rollback, "rollback", app.RollbackRestore, "action on startup failure ("+strings.Join(app.RollbackModes(), ", ")+")")
+	startCmd.Flags().BoolVar(&startCmdArgs.Flags.All, "all", false, "start all stopped profiles")
+	startCmd.Flags().IntVar(&startCmdArgs.Flags.Parallel, "parallel", 4, "maximum number of profiles to start concurrently, each in a separate process")
 
 	// mounts
 	startCmd.Flags().StringSliceVarP(&startCmdArgs.Flags.Mounts, "mount", "V", nil, "directories to mount, suffix ':w' for writable, disable with 'none'")
@@ -421,14 +473,16 @@ func setConfigDefaults(conf *config.Config) {
 	}
 }
 
-func setFixedConfigs(conf *config.Config) {
-	fixedConf, err := configmanager.LoadFrom(config.CurrentProfile().StateFile())
+// setFixedConfigs overrides the configs that cannot be changed after initial setup,
+// warning about discarded changes if warn is true.
+func setFixedConfigs(conf *config.Config, warn bool) {
+	fixedConf, err := configmanager.LoadInstance()
 	if err != nil {
 		return
 	}
 
 	warnIfNotEqual := func(name, newVal, fixedVal string) {
-		if newVal != fixedVal {
+		if warn && newVal != fixedVal {
 			log.Warnln(fmt.Errorf("'%s' cannot be updated after initial setup, discarded", name))
 		}
 	}
@@ -452,7 +506,9 @@ func setFixedConfigs(conf *config.Config) {
 		conf.MountType = fixedConf.MountType
 	}
 	if fixedConf.Network.Address && !conf.Network.Address {
-		log.Warnln("network address cannot be disabled once enabled")
+		if warn {
+			log.Warnln("network address cannot be disabled once enabled")
+		}
 		conf.Network.Address = true
 	}
 	if fixedConf.Network.Mode != "" {
@@ -461,24 +517,38 @@ func setFixedConfigs(conf *config.Config) {
 	}
 }
 
-func prepareConfig(cmd *cobra.Command) {
-	current, err := configmanager.Load()
-	if err != nil {
-		// not fatal, will proceed with defaults
-		log.Warnln(fmt.Errorf("config load failed: %w", err))
-		log.Warnln("reverting to default settings")
+// configLayers returns the config file layers for the current profile.
+// The template is only included if enabled.
+func configLayers(template bool) (configmanager.Layers, error) {
+	var layers []configmanager.Layer
+	if template {
+		layers = append(layers, configmanager.Layer{Name: configmanager.LayerTemplate, File: templateFile()})
 	}
-
-	// handle legacy kubernetes flag
-	if cmd.Flag("with-kubernetes").Changed {
-		startCmdArgs.Kubernetes.Enabled = startCmdArgs.Flags.LegacyKubernetes
-		cmd.Flag("kubernetes").Changed = true
+	layers = append(layers, configmanager.Layer{Name: configmanager.LayerProfile, File: config.CurrentProfile().File()})
+	if wd, err := os.Getwd(); err == nil {
+		layers = append(layers, configmanager.Layer{Name: configmanager.LayerProject, File: configmanager.FindProjectFile(wd)})
 	}
+	return configmanager.LoadLayers(layers...)
+}
 
-	// handle legacy cpu flag
-	if cmd.Flag("cpu").Changed && !cmd.Flag("cpus").Changed {
-		startCmdArgs.CPU = startCmdArgs.Flags.LegacyCPU
-		cmd.Flag("cpus").Changed = true
+// prepareConfig combines the config layers in the order of precedence:
+//
+//	built-in defaults -> template -> profile config -> project config -> flags
+//
+// The project config is not persisted in the profile config.
+// An error is returned if a config file cannot be loaded, the config file
+// would otherwise be overwritten with the default settings.
+func prepareConfig(cmd *cobra.Command) error {
+	layers, err := configLayers(startCmdArgs.Flags.Template)
+	if err != nil {
+		// the project config is from the current directory and must never affect the profile config
+		if errors.As(err, &configmanager.ProjectConfigError{}) {
+			return fmt.Errorf("%w\nhint: fix or remove the project config, or start from another directory. The profile config is unchanged", err)
+		}
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if project, ok := layers.Get(configmanager.LayerProject); ok {
+		log.Println("using project config:", project.File)
 	}
 
 	// convert cli to config file format
@@ -491,174 +561,209 @@ func prepareConfig(cmd *cobra.Command) {
 		startCmdArgs.Docker = withRegistryMirrors(startCmdArgs.Docker, startCmdArgs.Flags.RegistryMirrors)
 	}
 
-	// handle legacy kubernetes-disable
-	for _, disable := range startCmdArgs.Flags.LegacyKubernetesDisable {
-		startCmdArgs.Kubernetes.K3sArgs = append(startCmdArgs.Kubernetes.K3sArgs, "--disable="+disable)
-	}
+	migrateLegacyFlags(cmd)
 
 	// set relevant missing default values
 	setFlagDefaults(cmd)
 
-	// if there is no existing settings
-	if current.Empty() {
-		templateUsed := false
+	flags := startCmdArgs.Config
+	startCmdArgs.profileConfig = flags
+	if err := applyConfigLayers(cmd, &startCmdArgs.profileConfig, layers.Without(configmanager.LayerProject)); err != nil {
+		return err
+	}
+	startCmdArgs.Config = flags
+	if err := applyConfigLayers(cmd, &startCmdArgs.Config, layers); err != nil {
+		return err
+	}
 
-		// attempt template if enabled
-		if startCmdArgs.Flags.Template {
-			template, err := configmanager.LoadFrom(templateFile())
-			if err == nil {
-				current = template
-				templateUsed = true
-			}
-		}
+	setFixedConfigs(&startCmdArgs.Config, true)
+	setFixedConfigs(&startCmdArgs.profileConfig, false)
+	return nil
+}
+
+// migrateLegacyFlags migrates the legacy flags like the keys of the same meaning in unversioned config files.
+func migrateLegacyFlags(cmd *cobra.Command) {
+	legacy := map[string]any{}
+	if cmd.Flag("cpu").Changed && !cmd.Flag("cpus").Changed {
+		legacy["cpu"] = startCmdArgs.Flags.LegacyCPU
+	}
+	if cmd.Flag("with-kubernetes").Changed {
+		legacy["kubernetes.enabled"] = startCmdArgs.Flags.LegacyKubernetes
+	}
+	if cmd.Flag("kubernetes-disable").Changed {
+		legacy["kubernetes.disable"] = startCmdArgs.Flags.LegacyKubernetesDisable
+	}
 
-		if !templateUsed {
-			// use default config if there is no template or template is disabled
-			return
+	keys, err := configmanager.MigrateLegacyValues(&startCmdArgs.Config, legacy)
+	if err != nil {
+		log.Warnln(fmt.Errorf("error migrating legacy flags: %w", err))
+		return
+	}
+	for _, key := range keys {
+		if flag, ok := configFlags[key]; ok {
+			cmd.Flag(flag).Changed = true
 		}
 	}
+}
+
+// applyConfigLayers applies the merged config of the layers to conf
+// for the settings that are not set by flags.
+func applyConfigLayers(cmd *cobra.Command, conf *config.Config, layers configmanager.Layers) error {
+	if len(layers) == 0 {
+		return nil
+	}
+	current, err := layers.Config()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
 
 	// set missing defaults in the current config
 	setConfigDefaults(&current)
 
 	// docker can only be set in config file, except registry mirrors via flag
-	startCmdArgs.Docker = current.Docker
+	conf.Docker = current.Docker
 	if cmd.Flag("registry-mirror").Changed {
-		startCmdArgs.Docker = withRegistryMirrors(startCmdArgs.Docker, startCmdArgs.Flags.RegistryMirrors)
-	}
-	// provision scripts can only be set in config file
-	startCmdArgs.Provision = current.Provision
+		conf.Docker = withRegistryMirrors(conf.Docker, startCmdArgs.Flags.RegistryMirrors)
+	}
+	// provision scripts, hooks, auto-stop and drain can only be set in config file
+	conf.Provision = current.Provision
+	conf.Hooks = current.Hooks
+	conf.AutoStop = current.AutoStop
+	conf.Drain = current.Drain
+	conf.Interpolated = current.Interpolated
+	// inheritance can only be set in config file
+	conf.Extends = current.Extends
+	conf.ListMerge = current.ListMerge
 
 	// use current settings for unchanged configs
 	// otherwise may be reverted to their default values.
 	if !cmd.Flag("arch").Changed {
-		startCmdArgs.Arch = current.Arch
+		conf.Arch = current.Arch
 	}
 	if !cmd.Flag("disk").Changed {
-		startCmdArgs.Disk = current.Disk
+		conf.Disk = current.Disk
 	}
 	if !cmd.Flag("root-disk").Changed {
 		if current.RootDisk > 0 {
-			startCmdArgs.RootDisk = current.RootDisk
+			conf.RootDisk = current.RootDisk
 		}
 	}
 	if !cmd.Flag("kubernetes").Changed {
-		startCmdArgs.Kubernetes.Enabled = current.Kubernetes.Enabled
+		conf.Kubernetes.Enabled = current.Kubernetes.Enabled
 	}
 	if !cmd.Flag("kubernetes-version").Changed && current.Kubernetes.Version != "" {
-		startCmdArgs.Kubernetes.Version = current.Kubernetes.Version
+		conf.Kubernetes.Version = current.Kubernetes.Version
 	}
 	if !cmd.Flag("k3s-arg").Changed && current.Kubernetes.K3sArgs != nil {
-		startCmdArgs.Kubernetes.K3sArgs = current.Kubernetes.K3sArgs
+		conf.Kubernetes.K3sArgs = current.Kubernetes.K3sArgs
 	}
 	if !cmd.Flag("k3s-listen-port").Changed && current.Kubernetes.Port > 0 {
-		startCmdArgs.Kubernetes.Port = current.Kubernetes.Port
+		conf.Kubernetes.Port = current.Kubernetes.Port
 	}
 	if !cmd.Flag("runtime").Changed {
-		startCmdArgs.Runtime = current.Runtime
+		conf.Runtime = current.Runtime
 	}
 	if util.MacOS13OrNewerOnArm() {
 		if !cmd.Flag("model-runner").Changed {
-			startCmdArgs.ModelRunner = current.ModelRunner
+			conf.ModelRunner = current.ModelRunner
 		}
 	}
 	if !cmd.Flag("cpus").Changed {
-		startCmdArgs.CPU = current.CPU
+		conf.CPU = current.CPU
 	}
 	if !cmd.Flag("cpu-type").Changed {
-		startCmdArgs.CPUType = current.CPUType
+		conf.CPUType = current.CPUType
 	}
 	if !cmd.Flag("memory").Changed {
-		startCmdArgs.Memory = current.Memory
+		conf.Memory = current.Memory
 	}
 	if !cmd.Flag("mount").Changed {
-		startCmdArgs.Mounts = current.Mounts
+		conf.Mounts = current.Mounts
 	}
 	if !cmd.Flag("mount-type").Changed {
-		startCmdArgs.MountType = current.MountType
+		conf.MountType = current.MountType
 	}
 	if !cmd.Flag("mount-inotify").Changed {
-		startCmdArgs.MountINotify = current.MountINotify
+		conf.MountINotify = current.MountINotify
 	}
 	if !cmd.Flag("ssh-agent").Changed {
-		startCmdArgs.ForwardAgent = current.ForwardAgent
+		conf.ForwardAgent = current.ForwardAgent
 	}
 	if !cmd.Flag("ssh-config").Changed {
-		startCmdArgs.SSHConfig = current.SSHConfig
+		conf.SSHConfig = current.SSHConfig
 	}
 	if !cmd.Flag("ssh-port").Changed {
-		startCmdArgs.SSHPort = current.SSHPort
+		conf.SSHPort = current.SSHPort
 	}
 	if !cmd.Flag("port-forwarder").Changed {
-		startCmdArgs.PortForwarder = current.PortForwarder
+		conf.PortForwarder = current.PortForwarder
 	}
 	if !cmd.Flag("dns").Changed {
-		startCmdArgs.Network.DNSResolvers = current.Network.DNSResolvers
+		conf.Network.DNSResolvers = current.Network.DNSResolvers
 	}
 	if !cmd.Flag("dns-host").Changed {
-		startCmdArgs.Network.DNSHosts = current.Network.DNSHosts
+		conf.Network.DNSHosts = current.Network.DNSHosts
 	}
 	if !cmd.Flag("gateway-address").Changed {
-		startCmdArgs.Network.GatewayAddress = current.Network.GatewayAddress
+		conf.Network.GatewayAddress = current.Network.GatewayAddress
 	}
 	if !cmd.Flag("env").Changed {
-		startCmdArgs.Env = current.Env
+		conf.Env = current.Env
 	}
 	if !cmd.Flag("hostname").Changed {
-		startCmdArgs.Hostname = current.Hostname
+		conf.Hostname = current.Hostname
 	}
 	if !cmd.Flag("activate").Changed {
 		if current.ActivateRuntime != nil { // backward compatibility for `activate`
-			startCmdArgs.ActivateRuntime = current.ActivateRuntime
+			conf.ActivateRuntime = current.ActivateRuntime
 		}
 	}
 	if !cmd.Flag("binfmt").Changed {
 		if current.Binfmt != nil {
-			startCmdArgs.Binfmt = current.Binfmt
+			conf.Binfmt = current.Binfmt
 		}
 	}
 	if !cmd.Flag("force-disk-image").Changed {
 		if current.ForceDiskImage != nil {
-			startCmdArgs.ForceDiskImage = current.ForceDiskImage
+			conf.ForceDiskImage = current.ForceDiskImage
 		}
 	}
 	if !cmd.Flag("disk-image-mirror").Changed {
-		startCmdArgs.DiskImageMirror = current.DiskImageMirror
+		conf.DiskImageMirror = current.DiskImageMirror
 	}
 	if !cmd.Flag("network-host-addresses").Changed {
-		startCmdArgs.Network.HostAddresses = current.Network.HostAddresses
+		conf.Network.HostAddresses = current.Network.HostAddresses
 	}
 	if util.MacOS() {
 		if !cmd.Flag("network-address").Changed {
-			startCmdArgs.Network.Address = current.Network.Address
+			conf.Network.Address = current.Network.Address
 		}
 		if !cmd.Flag("network-mode").Changed {
-			startCmdArgs.Network.Mode = current.Network.Mode
+			conf.Network.Mode = current.Network.Mode
 		}
 		if !cmd.Flag("network-interface").Changed {
-			startCmdArgs.Network.BridgeInterface = current.Network.BridgeInterface
+			conf.Network.BridgeInterface = current.Network.BridgeInterface
 		}
 		if !cmd.Flag("network-preferred-route").Changed {
-			startCmdArgs.Network.PreferredRoute = current.Network.PreferredRoute
+			conf.Network.PreferredRoute = current.Network.PreferredRoute
 		}
 		if util.MacOS13OrNewer() {
 			if !cmd.Flag("vm-type").Changed {
-				startCmdArgs.VMType = current.VMType
+				conf.VMType = current.VMType
 			}
 		}
 		if util.MacOS13OrNewerOnArm() {
 			if !cmd.Flag("vz-rosetta").Changed {
-				startCmdArgs.VZRosetta = current.VZRosetta
+				conf.VZRosetta = current.VZRosetta
 			}
 		}
 		if util.MacOSNestedVirtualizationSupported() {
 			if !cmd.Flag("nested-virtualization").Changed {
-				startCmdArgs.NestedVirtualization = current.NestedVirtualization
+				conf.NestedVirtualization = current.NestedVirtualization
 			}
 		}
 	}
-
-	setFixedConfigs(&startCmdArgs.Config)
+	return nil
 }
 
 // editConfigFile launches an editor to edit the config file.
@@ -690,16 +795,150 @@ func editConfigFile() (config.Config, error) {
 	defer func() {
 		_ = os.Remove(tmpFile)
 	}()
+
+	// validate before saving, the positions of problems match the edited file
+	c, loadErr := configmanager.LoadResolved(tmpFile)
+	if err := configmanager.ValidateConfigFile(c, tmpFile, validationHost()); err != nil {
+		return c, fmt.Errorf("error in config file: %w", err)
+	}
+	if loadErr != nil {
+		return c, loadErr
+	}
+
 	if startCmdArgs.Flags.SaveConfig {
-		if err := configmanager.SaveFromFile(tmpFile); err != nil {
+		// the edited file is saved as is, values of the extended config must not be copied to it
+		if c.Extends != "" {
+			edited, err := os.ReadFile(tmpFile)
+			if err != nil {
+				return c, fmt.Errorf("error reading edited config file: %w", err)
+			}
+			edited = bytes.TrimPrefix(edited, []byte(abort+"\n"))
+			if err := fsutil.WriteFileAtomic(config.CurrentProfile().File(), edited, 0644); err != nil {
+				return c, fmt.Errorf("error saving config file: %w", err)
+			}
+			return c, nil
+		}
+		if err := configmanager.Save(c); err != nil {
 			return c, err
 		}
 	}
-	return configmanager.LoadFrom(tmpFile)
+	return c, nil
+}
+
+// validateStartConfig validates the startup config.
+// Problems of values from the config file are reported with their position in the file.
+// The file is validated after editing with --edit.
+func validateStartConfig() error {
+	host := validationHost()
+	if _, err := os.Stat(config.CurrentProfile().File()); err == nil && !startCmdArgs.Flags.Edit {
+		return configmanager.ValidateConfigFile(startCmdArgs.Config, config.CurrentProfile().File(), host)
+	}
+	return configmanager.ValidateConfig(startCmdArgs.Config, host)
+}
+
+// validationHost returns the state of the host and the existing instance
+// for the host-aware validation of the config.
+func validationHost() *configmanager.Host {
+	host := configmanager.CurrentHost()
+	if instance, err := limautil.Instance(); err == nil {
+		host.Running = instance.Running()
+		// disk sizes the runtime disk, not the root disk of the instance
+		if current, err := configmanager.LoadInstance(); err == nil {
+			host.DiskSize = current.Disk
+		}
+	}
+	return &host
+}
+
+// applyChanges applies the edited config to the running instance
+// with the minimum action required by the changes.
+func applyChanges(a app.App, conf config.Config) error {
+	class := config.ChangeVMRestart
+
+	// the changes are unknown without the state of the instance, restart to be safe
+	if current, err := configmanager.LoadInstance(); err != nil {
+		log.Traceln(fmt.Errorf("error loading instance config: %w", err))
+	} else {
+		changes, err := config.Diff(current, conf)
+		if err != nil {
+			return fmt.Errorf("error comparing config: %w", err)
+		}
+		if len(changes) == 0 {
+			log.Println("no changes to apply")
+			return nil
+		}
+		if err := printChanges(cli.Stdout(), changes); err != nil {
+			return err
+		}
+
+		class = changes.Class()
+		switch class {
+		case config.ChangeRecreate:
+			return fmt.Errorf("changes require the VM to be recreated, run 'colima delete' and start again to apply")
+		case config.ChangeLive, config.ChangeRuntimeRestart:
+			if !cli.Prompt(fmt.Sprintf("colima is currently running, apply changes (%s)", class)) {
+				return nil
+			}
+			return a.Reconfigure(conf, changes)
+		}
+	}
+
+	if !cli.Prompt("colima is currently running, restart to apply changes") {
+		return nil
+	}
+	if err := a.Stop(false); err != nil {
+		return fmt.Errorf("error stopping :%w", err)
+	}
+	// pause before startup to prevent race condition
+	time.Sleep(time.Second * 3)
+
+	return start(a, conf)
+}
+
+// planRunning prints what start would do for the running instance with the config.
+// The running instance is left as is, changes of the config are only listed.
+func planRunning(conf config.Config) error {
+	log.Println("already running, start would not make any changes")
+
+	current, err := configmanager.LoadInstance()
+	if err != nil {
+		log.Traceln(fmt.Errorf("error loading instance config: %w", err))
+		return nil
+	}
+	changes, err := config.Diff(current, conf)
+	if err != nil {
+		return fmt.Errorf("error comparing config: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	log.Println("config changes are not applied to the running instance, apply them with 'colima start --edit' or a restart")
+	return printChanges(cli.Stdout(), changes)
+}
+
+// printChanges prints the config changes and the action required by each.
+func printChanges(w io.Writer, changes config.Changes) error {
+	value := func(v any) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprint(v)
+	}
+
+	t := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(t, "KEY\tOLD\tNEW\tACTION")
+	for _, c := range changes {
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", c.Key, value(c.Old), value(c.New), c.Class)
+	}
+	return t.Flush()
+}
+
+func appStartOptions() app.StartOptions {
+	return app.StartOptions{Rollback: startCmdArgs.Flags.Rollback}
 }
 
 func start(app app.App, conf config.Config) error {
-	if err := app.Start(conf); err != nil {
+	if err := app.Start(conf, appStartOptions()); err != nil {
 		return err
 	}
 	if startCmdArgs.Flags.Foreground {
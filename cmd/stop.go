@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/spf13/cobra"
 )
 
 var stopCmdArgs struct {
-	force bool
+	force    bool
+	all      bool
+	parallel int
 }
 
 // stopCmd represents the stop command
@@ -17,14 +20,36 @@ var stopCmd = &cobra.Command{
 
 The state of the VM is persisted at stop. A start afterwards
 should return it back to its previous state.`,
+	Example: "  colima stop\n" +
+		"  colima stop --all\n" +
+		"  colima stop --profile 'ci-*'",
 	Args: cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupOutput(cmd.OutOrStdout(), cmd.ErrOrStderr())
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if pattern, ok := profileSelector(stopCmdArgs.all); ok {
+			profiles, err := selectProfiles(pattern, limautil.InstanceInfo.Running)
+			if err != nil {
+				return err
+			}
+			args := []string{"stop"}
+			if stopCmdArgs.force {
+				args = append(args, "--force")
+			}
+			return runProfiles(cmd, profiles, stopCmdArgs.parallel, args...)
+		}
+
 		return newApp().Stop(stopCmdArgs.force)
 	},
 }
 
 func init() {
 	root.Cmd().AddCommand(stopCmd)
+	addOutputFlag(stopCmd)
+	addLockFlags(stopCmd.Flags())
 
 	stopCmd.Flags().BoolVarP(&stopCmdArgs.force, "force", "f", false, "stop without graceful shutdown")
+	stopCmd.Flags().BoolVar(&stopCmdArgs.all, "all", false, "stop all running profiles")
+	stopCmd.Flags().IntVar(&stopCmdArgs.parallel, "parallel", 4, "maximum number of profiles to stop concurrently, each in a separate process")
 }
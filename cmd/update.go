@@ -19,4 +19,5 @@ var updateCmd = &cobra.Command{
 
 func init() {
 	root.Cmd().AddCommand(updateCmd)
+	addLockFlags(updateCmd.Flags())
 }
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -11,7 +13,10 @@ import (
 
 	"github.com/abiosoft/colima/app"
 	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func newApp() app.App {
@@ -102,3 +107,72 @@ func launchEditor(editor string, file string) error {
 
 	return cli.CommandInteractive("sh", "-c", editor+" "+file).Run()
 }
+
+// lifecycleOutput is the output format for lifecycle commands.
+var lifecycleOutput string
+
+// eventOutput is where lifecycle events are written for json output.
+var eventOutput io.Writer = os.Stdout
+
+// addOutputFlag adds the output format flag to a lifecycle command.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&lifecycleOutput, "output", "text", "output format (text, json)")
+}
+
+// setupOutput prepares the output for a lifecycle command.
+// For json output, lifecycle events are written to events one per line
+// and the output of the command and its subprocesses is written to output.
+func setupOutput(events, output io.Writer) error {
+	switch lifecycleOutput {
+	case "", "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid output format: '%s'", lifecycleOutput)
+	}
+
+	eventOutput = events
+	enc := json.NewEncoder(events)
+	profile := config.CurrentProfile().ShortName
+	cli.OnEvent(func(e cli.Event) {
+		e.Profile = profile
+		if err := enc.Encode(e); err != nil {
+			logrus.Traceln(fmt.Errorf("error encoding event: %w", err))
+		}
+	})
+
+	// keep the events exclusive to their output
+	cli.Settings.Stdout = output
+	return nil
+}
+
+// addLockFlags adds the flags for lifecycle commands in progress on the profile, see app.Lock.
+func addLockFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&app.LockWait, "wait", app.LockWait, "wait for a command in progress on the profile to finish")
+	noWait := flags.VarPF(noWaitFlag{}, "no-wait", "", "fail if a command is in progress on the profile")
+	noWait.NoOptDefVal = "true"
+}
+
+// noWaitFlag is the inverse of app.LockWait.
+type noWaitFlag struct{}
+
+func (noWaitFlag) String() string { return strconv.FormatBool(!app.LockWait) }
+func (noWaitFlag) Type() string   { return "bool" }
+func (noWaitFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	app.LockWait = !v
+	return nil
+}
+
+// withLock runs f while holding the lock of the current profile, see app.Lock.
+func withLock(f func() error) error {
+	unlock, err := app.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return f()
+}
@@ -0,0 +1,329 @@
+// Package bundle exports and imports Colima profiles as tar.gz bundles.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/yamlutil"
+)
+
+// Version is the version of the bundle format.
+const Version = 1
+
+// Bundle entries.
+const (
+	manifestFile  = "manifest.json"
+	configFile    = "colima.yaml"
+	templateFile  = "template.yaml"
+	containerdDir = "containerd"
+	filesDir      = "files"
+	disksDir      = "disks"
+)
+
+// containerdFiles are the per-profile containerd and buildkitd overrides in the config directory.
+var containerdFiles = []string{"config.toml", "buildkitd.toml"}
+
+// diskFiles are the files of the VM in the Lima instance directory, as copied by `colima clone`.
+var diskFiles = []string{"basedisk", "diffdisk", "cidata.iso", "lima.yaml"}
+
+// Manifest describes the content of a bundle.
+type Manifest struct {
+	Version       int        `json:"version"`
+	Profile       string     `json:"profile"`
+	ColimaVersion string     `json:"colimaVersion"`
+	Created       time.Time  `json:"created"`
+	Files         []string   `json:"files"`
+	Redacted      []Redacted `json:"redacted,omitempty"`
+	Disks         bool       `json:"disks"`
+}
+
+// ExportOptions are the options for exporting a profile.
+type ExportOptions struct {
+	// Template is the template file, included if it exists.
+	Template string
+	// Disks includes the VM disks. The VM must not be running.
+	Disks bool
+}
+
+// Export writes the bundle of the profile to w.
+func Export(w io.Writer, name string, p config.ProfileInfo, opts ExportOptions) (Manifest, error) {
+	m := Manifest{
+		Version:       Version,
+		Profile:       name,
+		ColimaVersion: config.AppVersion().Version,
+		Created:       time.Now().UTC(),
+		Disks:         opts.Disks,
+	}
+
+	if _, err := os.Stat(p.File()); err != nil {
+		return m, fmt.Errorf("config missing for profile '%s': %w", name, err)
+	}
+	doc, err := yamlutil.ReadNode(p.File())
+	if err != nil {
+		return m, fmt.Errorf("error reading profile config: %w", err)
+	}
+	m.Redacted = redactFile(configFile, redact(doc.Content[0]))
+	files := bundleFiles(doc.Content[0], p.ConfigDir())
+	conf, err := yamlutil.EncodeNode(doc)
+	if err != nil {
+		return m, fmt.Errorf("error encoding profile config: %w", err)
+	}
+
+	var entries []entry
+	entries = append(entries, entry{name: configFile, data: conf})
+	for _, f := range containerdFiles {
+		b, err := os.ReadFile(filepath.Join(p.ConfigDir(), containerdDir, f))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return m, fmt.Errorf("error reading containerd config: %w", err)
+		}
+		name := path.Join(containerdDir, f)
+		b, keys := redactTOML(b)
+		for _, key := range keys {
+			m.Redacted = append(m.Redacted, Redacted{File: name, Key: key})
+		}
+		entries = append(entries, entry{name: name, data: b})
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		entries = append(entries, entry{name: path.Join(filesDir, name), file: files[name]})
+	}
+	if _, err := os.Stat(opts.Template); opts.Template != "" && err == nil {
+		doc, err := yamlutil.ReadNode(opts.Template)
+		if err != nil {
+			return m, fmt.Errorf("error reading template: %w", err)
+		}
+		m.Redacted = append(m.Redacted, redactFile(templateFile, redact(doc.Content[0]))...)
+		b, err := yamlutil.EncodeNode(doc)
+		if err != nil {
+			return m, fmt.Errorf("error encoding template: %w", err)
+		}
+		entries = append(entries, entry{name: templateFile, data: b})
+	}
+	if opts.Disks {
+		for _, f := range diskFiles {
+			file := filepath.Join(p.LimaInstanceDir(), f)
+			if _, err := os.Stat(file); err != nil {
+				return m, fmt.Errorf("VM disk missing for profile '%s': %w", name, err)
+			}
+			entries = append(entries, entry{name: path.Join(disksDir, f), file: file})
+		}
+	}
+
+	// optional files are skipped if missing
+	var included []entry
+	for _, e := range entries {
+		if e.file != "" {
+			if _, err := os.Stat(e.file); err != nil {
+				continue
+			}
+		}
+		included = append(included, e)
+		m.Files = append(m.Files, e.name)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if err := writeEntry(tw, entry{name: manifestFile, data: manifest}); err != nil {
+		return m, err
+	}
+	for _, e := range included {
+		if err := writeEntry(tw, e); err != nil {
+			return m, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return m, fmt.Errorf("error writing bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return m, fmt.Errorf("error writing bundle: %w", err)
+	}
+	return m, nil
+}
+
+// ImportOptions are the options for importing a profile.
+type ImportOptions struct {
+	// Template is the template file, only written if it does not exist.
+	Template string
+	// Force overwrites the config of an existing profile.
+	Force bool
+}
+
+// ReadManifest reads the manifest of the bundle from r.
+func ReadManifest(r io.Reader) (Manifest, error) {
+	m, _, err := readManifest(r)
+	return m, err
+}
+
+// readManifest reads the manifest, the first entry of the bundle.
+// The reader of the remaining entries is returned.
+func readManifest(r io.Reader) (Manifest, *tar.Reader, error) {
+	var m Manifest
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	h, err := tr.Next()
+	if err != nil || h.Name != manifestFile {
+		return m, nil, fmt.Errorf("invalid bundle: manifest missing")
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if m.Version > Version {
+		return m, nil, fmt.Errorf("bundle version %d is not supported by this version of colima, upgrade colima to the latest version", m.Version)
+	}
+	return m, tr, nil
+}
+
+// Import extracts the bundle from r into the profile.
+// The manifest is returned, with Files limited to the extracted files.
+func Import(r io.Reader, p config.ProfileInfo, opts ImportOptions) (Manifest, error) {
+	m, tr, err := readManifest(r)
+	if err != nil {
+		return m, err
+	}
+
+	if _, err := os.Stat(p.File()); err == nil && !opts.Force {
+		return m, fmt.Errorf("config already exists for profile, delete the profile or import with --force")
+	}
+	if m.Disks {
+		if _, err := os.Stat(filepath.Join(p.LimaInstanceDir(), diskFiles[0])); err == nil {
+			return m, fmt.Errorf("VM already exists for profile, delete the profile to import the disks")
+		}
+	}
+
+	var extracted []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, fmt.Errorf("error reading bundle: %w", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		target, ok := importTarget(h.Name, p, opts)
+		if !ok {
+			continue
+		}
+		if err := extract(tr, target, h.FileInfo().Mode()); err != nil {
+			return m, err
+		}
+		extracted = append(extracted, h.Name)
+	}
+
+	m.Files = extracted
+	return m, nil
+}
+
+// importTarget returns the file the bundle entry is extracted to.
+// Unknown entries are ignored, entries cannot be extracted outside of the profile directories.
+func importTarget(name string, p config.ProfileInfo, opts ImportOptions) (string, bool) {
+	dir, file := path.Split(path.Clean(name))
+	dir = strings.TrimSuffix(dir, "/")
+	if file == "" || file == "." || file == ".." {
+		return "", false
+	}
+
+	switch {
+	case dir == "" && file == configFile:
+		return p.File(), true
+	case dir == "" && file == templateFile:
+		if opts.Template == "" {
+			return "", false
+		}
+		// an existing template is not replaced, it applies to all profiles
+		if _, err := os.Stat(opts.Template); err == nil {
+			return "", false
+		}
+		return opts.Template, true
+	case dir == containerdDir && slices.Contains(containerdFiles, file):
+		return filepath.Join(p.ConfigDir(), containerdDir, file), true
+	case dir == filesDir:
+		return filepath.Join(p.ConfigDir(), filesDir, file), true
+	case dir == disksDir && slices.Contains(diskFiles, file):
+		return filepath.Join(p.LimaInstanceDir(), file), true
+	}
+	return "", false
+}
+
+func extract(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("error creating directory for '%s': %w", target, err)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("error creating '%s': %w", target, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("error extracting '%s': %w", target, err)
+	}
+	return f.Close()
+}
+
+// entry is a bundle entry with either the data or the file to read it from.
+type entry struct {
+	name string
+	data []byte
+	file string
+}
+
+func writeEntry(tw *tar.Writer, e entry) error {
+	if e.file == "" {
+		h := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(h); err != nil {
+			return fmt.Errorf("error writing '%s' to bundle: %w", e.name, err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return fmt.Errorf("error writing '%s' to bundle: %w", e.name, err)
+		}
+		return nil
+	}
+
+	f, err := os.Open(e.file)
+	if err != nil {
+		return fmt.Errorf("error reading '%s': %w", e.file, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading '%s': %w", e.file, err)
+	}
+	h := &tar.Header{Name: e.name, Mode: int64(stat.Mode().Perm()), Size: stat.Size(), ModTime: stat.ModTime()}
+	if err := tw.WriteHeader(h); err != nil {
+		return fmt.Errorf("error writing '%s' to bundle: %w", e.name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("error writing '%s' to bundle: %w", e.name, err)
+	}
+	return nil
+}
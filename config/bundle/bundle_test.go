@@ -0,0 +1,212 @@
+package bundle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+type testProfile struct{ dir string }
+
+func (p testProfile) ConfigDir() string       { return filepath.Join(p.dir, "config") }
+func (p testProfile) LimaInstanceDir() string { return filepath.Join(p.dir, "lima") }
+func (p testProfile) File() string            { return filepath.Join(p.ConfigDir(), "colima.yaml") }
+func (p testProfile) LimaFile() string        { return filepath.Join(p.LimaInstanceDir(), "lima.yaml") }
+func (p testProfile) StateFile() string       { return filepath.Join(p.LimaInstanceDir(), "colima.yaml") }
+func (p testProfile) StoreFile() string       { return filepath.Join(p.dir, "store.json") }
+
+func TestRedact(t *testing.T) {
+	const conf = `env:
+  GITHUB_TOKEN: ghp_secret
+  NPM_TOKEN: ${NPM_TOKEN}
+  EDITOR: vim
+docker:
+  registry-password: hunter2
+  insecure-registries: [registry.local]
+kubernetes:
+  k3sArgs: [--disable=traefik, --token=secret]
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(conf), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	got := redact(doc.Content[0])
+	want := []Redacted{
+		{Key: "env.GITHUB_TOKEN", Variable: "GITHUB_TOKEN"},
+		{Key: "docker.registry-password", Variable: "DOCKER_REGISTRY_PASSWORD"},
+		{Key: "kubernetes.k3sArgs.1", Variable: "KUBERNETES_K3SARGS_1_TOKEN"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redact() = %v, want %v", got, want)
+	}
+
+	b, _ := yaml.Marshal(&doc)
+	for _, secret := range []string{"ghp_secret", "hunter2", "=secret"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("secret %s not redacted\n%s", secret, b)
+		}
+	}
+	for _, kept := range []string{"${NPM_TOKEN}", "vim", "registry.local", "--disable=traefik"} {
+		if !strings.Contains(string(b), kept) {
+			t.Errorf("value %s not retained\n%s", kept, b)
+		}
+	}
+}
+
+func TestRedactTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want string
+		keys []string
+	}{
+		{
+			name: "no secrets",
+			toml: "debug = true\n[registry.\"docker.io\"]\n  mirrors = [\"mirror.local\"]\n",
+			want: "debug = true\n[registry.\"docker.io\"]\n  mirrors = [\"mirror.local\"]\n",
+		},
+		{
+			name: "auth table",
+			toml: "[plugins.cri.registry.configs.\"ghcr.io\".auth]\n  username = \"user\"\n  password = \"hunter2\" # comment\n",
+			want: "[plugins.cri.registry.configs.\"ghcr.io\".auth]\n  username = \"\"\n  password = \"\"\n",
+			keys: []string{`plugins.cri.registry.configs."ghcr.io".auth.username`, `plugins.cri.registry.configs."ghcr.io".auth.password`},
+		},
+		{
+			name: "inline table",
+			toml: "[registry]\n  auth = { username = \"user\", password = \"hunter2\" }\n",
+			want: "[registry]\n  auth = {}\n",
+			keys: []string{"registry.auth"},
+		},
+		{
+			name: "multi-line value",
+			toml: "identitytoken = \"\"\"\nhunter2\n\"\"\"\ndebug = true\n",
+			want: "identitytoken = \"\"\ndebug = true\n",
+			keys: []string{"identitytoken"},
+		},
+		{
+			name: "quoted names are not secrets",
+			toml: "[registry.\"auth.example.com\"]\n  insecure = true\n",
+			want: "[registry.\"auth.example.com\"]\n  insecure = true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, keys := redactTOML([]byte(tt.toml))
+			if string(got) != tt.want {
+				t.Errorf("redactTOML() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("redactTOML() keys = %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := testProfile{dir: t.TempDir()}
+	write := func(file, content string) {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(src.File(), "cpu: 4\nenv:\n  API_KEY: secret\nprovision:\n  - mode: system\n    script: ${file:scripts/setup.sh}\n")
+	write(filepath.Join(src.ConfigDir(), "scripts", "setup.sh"), "echo setup")
+	write(filepath.Join(src.ConfigDir(), "containerd", "buildkitd.toml"), "debug = true")
+	write(filepath.Join(src.ConfigDir(), "containerd", "config.toml"),
+		"[plugins.\"io.containerd.grpc.v1.cri\".registry.configs.\"ghcr.io\".auth]\n  password = \"hunter2\"\n")
+	template := filepath.Join(src.dir, "template.yaml")
+	write(template, "memory: 8\nenv:\n  NPM_TOKEN: npm_secret\n")
+
+	var buf bytes.Buffer
+	m, err := Export(&buf, "work", src, ExportOptions{Template: template})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{"colima.yaml", "containerd/config.toml", "containerd/buildkitd.toml", "files/setup.sh", "template.yaml"}
+	if !reflect.DeepEqual(m.Files, wantFiles) {
+		t.Errorf("exported files %v, want %v", m.Files, wantFiles)
+	}
+
+	manifest, err := ReadManifest(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Profile != "work" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	wantRedacted := []Redacted{
+		{File: "colima.yaml", Key: "env.API_KEY", Variable: "API_KEY"},
+		{File: "containerd/config.toml", Key: `plugins."io.containerd.grpc.v1.cri".registry.configs."ghcr.io".auth.password`},
+		{File: "template.yaml", Key: "env.NPM_TOKEN", Variable: "NPM_TOKEN"},
+	}
+	if !reflect.DeepEqual(manifest.Redacted, wantRedacted) {
+		t.Errorf("redacted %v, want %v", manifest.Redacted, wantRedacted)
+	}
+
+	dst := testProfile{dir: t.TempDir()}
+	dstTemplate := filepath.Join(dst.dir, "template.yaml")
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, ImportOptions{Template: dstTemplate}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(dst.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "API_KEY: ${API_KEY}") || !strings.Contains(string(b), "${file:files/setup.sh}") {
+		t.Errorf("unexpected imported config\n%s", b)
+	}
+	for file, content := range map[string]string{
+		filepath.Join(dst.ConfigDir(), "files", "setup.sh"):            "echo setup",
+		filepath.Join(dst.ConfigDir(), "containerd", "buildkitd.toml"): "debug = true",
+		filepath.Join(dst.ConfigDir(), "containerd", "config.toml"):    "[plugins.\"io.containerd.grpc.v1.cri\".registry.configs.\"ghcr.io\".auth]\n  password = \"\"\n",
+		dstTemplate: "memory: 8\nenv:\n  NPM_TOKEN: ${NPM_TOKEN}\n",
+	} {
+		if b, err := os.ReadFile(file); err != nil || string(b) != content {
+			t.Errorf("unexpected content of %s: %q, %v", file, b, err)
+		}
+	}
+
+	// existing profiles are not replaced
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, ImportOptions{}); err == nil {
+		t.Errorf("expected error importing into existing profile")
+	}
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, ImportOptions{Force: true}); err != nil {
+		t.Errorf("unexpected error importing with force: %v", err)
+	}
+}
+
+func TestImportTarget(t *testing.T) {
+	p := testProfile{dir: "/tmp/profile"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "colima.yaml", want: p.File()},
+		{name: "containerd/config.toml", want: "/tmp/profile/config/containerd/config.toml"},
+		{name: "files/setup.sh", want: "/tmp/profile/config/files/setup.sh"},
+		{name: "disks/diffdisk", want: "/tmp/profile/lima/diffdisk"},
+		{name: "../colima.yaml"},
+		{name: "files/../../etc/passwd"},
+		{name: "/etc/passwd"},
+		{name: "containerd/other.toml"},
+		{name: "template.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := importTarget(tt.name, p, ImportOptions{})
+			if got != tt.want {
+				t.Errorf("importTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
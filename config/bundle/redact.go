@@ -0,0 +1,250 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/abiosoft/colima/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted is a secret that has been removed from a file of the bundle.
+// Secrets of yaml files are replaced with an environment variable,
+// secrets of toml files are emptied as they are not expanded.
+type Redacted struct {
+	File     string `json:"file"`
+	Key      string `json:"key"`
+	Variable string `json:"variable,omitempty"`
+}
+
+// secretPattern matches the keys of values that are considered secrets.
+var secretPattern = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|credential|api[-_]?key|private[-_]?key|auth)`)
+
+// variablePattern matches the characters that are not valid in environment variable names.
+var variablePattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// redact replaces the secrets in the config with references to environment variables,
+// which are expanded when the config is loaded. Existing references are retained.
+func redact(root *yaml.Node) []Redacted {
+	var redacted []Redacted
+
+	var walk func(key, name string, node *yaml.Node, secret bool)
+	walk = func(key, name string, node *yaml.Node, secret bool) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				childKey := k
+				if key != "" {
+					childKey = key + "." + k
+				}
+				// environment variables retain their names
+				childName := k
+				if key != "env" {
+					childName = strings.Trim(name+"_"+k, "_")
+				}
+				walk(childKey, childName, node.Content[i+1], secret || secretPattern.MatchString(k))
+			}
+		case yaml.SequenceNode:
+			for i, n := range node.Content {
+				walk(fmt.Sprintf("%s.%d", key, i), fmt.Sprintf("%s_%d", name, i), n, secret)
+			}
+		case yaml.ScalarNode:
+			if node.Tag == "!!null" || node.Value == "" || strings.HasPrefix(node.Value, "${") {
+				return
+			}
+			if secret {
+				v := variable(name)
+				node.Value, node.Tag, node.Style = "${"+v+"}", "!!str", 0
+				redacted = append(redacted, Redacted{Key: key, Variable: v})
+				return
+			}
+			// flags e.g. --token=secret
+			if flag, value, ok := strings.Cut(node.Value, "="); ok && strings.HasPrefix(flag, "-") &&
+				secretPattern.MatchString(flag) && !strings.HasPrefix(value, "${") {
+				v := variable(name + "_" + flag)
+				node.Value = flag + "=${" + v + "}"
+				redacted = append(redacted, Redacted{Key: key, Variable: v})
+			}
+		}
+	}
+	walk("", "", root, false)
+
+	return redacted
+}
+
+// tomlTablePattern matches a table header of a toml file.
+var tomlTablePattern = regexp.MustCompile(`^\s*\[\[?\s*(.*?)\s*\]\]?\s*(#.*)?$`)
+
+// tomlKeyPattern matches a key-value line of a toml file.
+var tomlKeyPattern = regexp.MustCompile(`^(\s*)([A-Za-z0-9_\-."' ]+?)(\s*=\s*)(.*)$`)
+
+// redactTOML empties the secrets in the toml file e.g. registry credentials of containerd,
+// the keys of the secrets are returned. A value is a secret if its key or table has a secret name.
+func redactTOML(b []byte) ([]byte, []string) {
+	var redacted []string
+	var table string
+	var out []string
+
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := tomlTablePattern.FindStringSubmatch(line); m != nil && !strings.Contains(line, "=") {
+			table = m[1]
+			out = append(out, line)
+			continue
+		}
+		m := tomlKeyPattern.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			out = append(out, line)
+			continue
+		}
+		key := strings.TrimSpace(m[2])
+		if table != "" {
+			key = table + "." + key
+		}
+		if !secretTOMLKey(key) {
+			out = append(out, line)
+			continue
+		}
+
+		value := strings.TrimSpace(m[4])
+		empty := `""`
+		switch {
+		case strings.HasPrefix(value, "{"):
+			empty = "{}"
+		case strings.HasPrefix(value, "["):
+			empty = "[]"
+		}
+		out = append(out, m[1]+m[2]+m[3]+empty)
+		redacted = append(redacted, key)
+
+		// the remaining lines of multi-line values
+		if end := tomlValueEnd(value); end != "" {
+			for i+1 < len(lines) {
+				i++
+				if strings.Contains(lines[i], end) {
+					break
+				}
+			}
+		}
+	}
+
+	return []byte(strings.Join(out, "\n")), redacted
+}
+
+// secretTOMLKey returns if a bare part of the dotted toml key has a secret name.
+// Quoted parts are names e.g. registry hosts.
+func secretTOMLKey(key string) bool {
+	var part strings.Builder
+	var quote rune
+	for _, r := range key + "." {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			part.Reset()
+		case r == '.':
+			if secretPattern.MatchString(part.String()) {
+				return true
+			}
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	return false
+}
+
+// tomlValueEnd returns the closing delimiter of a value that continues on the next lines.
+func tomlValueEnd(value string) string {
+	for _, delim := range []string{`"""`, "'''"} {
+		if strings.HasPrefix(value, delim) && strings.Count(value, delim) == 1 {
+			return delim
+		}
+	}
+	if strings.HasPrefix(value, "[") && strings.Count(value, "[") > strings.Count(value, "]") {
+		return "]"
+	}
+	return ""
+}
+
+// redactFile sets the file of the redacted secrets.
+func redactFile(file string, redacted []Redacted) []Redacted {
+	for i := range redacted {
+		redacted[i].File = file
+	}
+	return redacted
+}
+
+// variable returns the environment variable name for the key name.
+func variable(name string) string {
+	return strings.Trim(strings.ToUpper(variablePattern.ReplaceAllString(name, "_")), "_")
+}
+
+// filePattern matches the file references of provision scripts.
+var filePattern = regexp.MustCompile(`\$?\$\{file:([^}]*)\}`)
+
+// bundleFiles returns the files referenced by the provision scripts, keyed by their name in the bundle.
+// The references are replaced with the location of the files when imported,
+// references to missing files are retained.
+func bundleFiles(root *yaml.Node, configDir string) map[string]string {
+	files := map[string]string{}
+
+	var provision *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "provision" {
+			provision = root.Content[i+1]
+		}
+	}
+	if provision == nil || provision.Kind != yaml.SequenceNode {
+		return files
+	}
+
+	names := map[string]string{}
+	for _, p := range provision.Content {
+		for i := 0; p.Kind == yaml.MappingNode && i+1 < len(p.Content); i += 2 {
+			if p.Content[i].Value != "script" {
+				continue
+			}
+			script := p.Content[i+1]
+			script.Value = filePattern.ReplaceAllStringFunc(script.Value, func(match string) string {
+				// escaped
+				if strings.HasPrefix(match, "$$") {
+					return match
+				}
+				file := filePattern.FindStringSubmatch(match)[1]
+				location := file
+				if location == "~" || strings.HasPrefix(location, "~/") {
+					location = filepath.Join(util.HomeDir(), location[1:])
+				}
+				if !filepath.IsAbs(location) {
+					location = filepath.Join(configDir, location)
+				}
+				if stat, err := os.Stat(location); err != nil || stat.IsDir() {
+					return match
+				}
+
+				name, ok := names[location]
+				if !ok {
+					name = filepath.Base(location)
+					for n := 1; files[name] != ""; n++ {
+						ext := filepath.Ext(location)
+						name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(filepath.Base(location), ext), n, ext)
+					}
+					names[location] = name
+					files[name] = location
+				}
+				return "${file:" + filesDir + "/" + name + "}"
+			})
+		}
+	}
+
+	return files
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/osutil"
@@ -29,6 +30,14 @@ var (
 
 // Config is the application config.
 type Config struct {
+	// Version is the version of the config format, 0 for config files created before versioning.
+	Version int `yaml:"version,omitempty"`
+
+	// Extends is the profile or template extended by the config, see ListMerge.
+	Extends string `yaml:"extends,omitempty"`
+	// ListMerge is how lists are combined with the lists of the extended config, see ListMergeReplace and ListMergeAppend.
+	ListMerge string `yaml:"listMerge,omitempty"`
+
 	CPU      int               `yaml:"cpu,omitempty"`
 	Disk     int               `yaml:"disk,omitempty"`
 	RootDisk int               `yaml:"rootDisk,omitempty"`
@@ -59,6 +68,9 @@ type Config struct {
 	MountType    string  `yaml:"mountType,omitempty"`
 	MountINotify bool    `yaml:"mountInotify,omitempty"`
 
+	// additional data disks
+	Disks []DataDisk `yaml:"disks,omitempty"`
+
 	// Runtime is one of docker, containerd.
 	Runtime         string `yaml:"runtime,omitempty"`
 	ActivateRuntime *bool  `yaml:"autoActivate,omitempty"`
@@ -74,8 +86,67 @@ type Config struct {
 
 	// provision scripts
 	Provision []Provision `yaml:"provision,omitempty"`
+
+	// host lifecycle hooks
+	Hooks Hooks `yaml:"hooks,omitempty"`
+
+	// AutoStop configuration
+	AutoStop AutoStop `yaml:"autoStop,omitempty"`
+
+	// Drain configuration
+	Drain Drain `yaml:"drain,omitempty"`
+
+	// Interpolated are the values with expanded variables,
+	// their original form is preserved when the config is saved.
+	Interpolated []Interpolated `yaml:"-"`
 }
 
+// List merge strategies of configs extending another config.
+const (
+	// ListMergeReplace replaces the lists of the extended config.
+	ListMergeReplace = "replace"
+	// ListMergeAppend appends to the lists of the extended config, excluding duplicate items.
+	ListMergeAppend = "append"
+)
+
+// Interpolated is a config value with expanded variables.
+type Interpolated struct {
+	// Path is the keys and list indexes of the value.
+	Path  []string
+	Raw   string
+	Value string
+}
+
+// Drain is the configuration for stopping containers before the VM is stopped.
+type Drain struct {
+	// Enabled defaults to true if not set.
+	Enabled *bool `yaml:"enabled"`
+	// Timeout is the time in seconds to wait for each container to stop before it is killed.
+	Timeout int `yaml:"timeout"`
+}
+
+// IsEnabled returns if draining is enabled.
+func (d Drain) IsEnabled() bool { return d.Enabled == nil || *d.Enabled }
+
+// TimeoutDuration returns the drain timeout for each container.
+func (d Drain) TimeoutDuration() time.Duration {
+	if d.Timeout <= 0 {
+		return defaultDrainTimeout
+	}
+	return time.Duration(d.Timeout) * time.Second
+}
+
+const defaultDrainTimeout = 10 * time.Second
+
+// AutoStop is the configuration for stopping the VM when idle.
+type AutoStop struct {
+	// IdleMinutes is the idle period before the VM is stopped, 0 disables.
+	IdleMinutes int `yaml:"idleMinutes"`
+}
+
+// Enabled returns if auto-stop is enabled.
+func (a AutoStop) Enabled() bool { return a.IdleMinutes > 0 }
+
 // Kubernetes is kubernetes configuration
 type Kubernetes struct {
 	Enabled bool     `yaml:"enabled"`
@@ -103,21 +174,71 @@ type Mount struct {
 	Writable   bool   `yaml:"writable"`
 }
 
-// Provision modes managed by Colima (not passed to Lima).
+// DataDisk is an additional disk of the VM. Data disks are retained when the VM
+// or the container data is deleted.
+type DataDisk struct {
+	Name string `yaml:"name"`
+	// Size is the size of the disk in GiB, it can only be increased.
+	Size       int    `yaml:"size"`
+	FSType     string `yaml:"fsType,omitempty"`
+	MountPoint string `yaml:"mountPoint,omitempty"`
+	// Format is if the disk is formatted on first use, defaults to true.
+	// A disk with a filesystem is never formatted.
+	Format *bool `yaml:"format,omitempty"`
+}
+
+// FSTypeOrDefault returns the filesystem type of the disk, ext4 if not set.
+func (d DataDisk) FSTypeOrDefault() string {
+	if d.FSType == "" {
+		return "ext4"
+	}
+	return d.FSType
+}
+
+// MountPointOrDefault returns the mount point of the disk in the VM, /mnt/<name> if not set.
+func (d DataDisk) MountPointOrDefault() string {
+	if d.MountPoint == "" {
+		return "/mnt/" + d.Name
+	}
+	return d.MountPoint
+}
+
+// FormatOrDefault returns if the disk is formatted on first use.
+func (d DataDisk) FormatOrDefault() bool { return d.Format == nil || *d.Format }
+
+// Hook events.
 const (
-	ProvisionModeAfterBoot = "after-boot"
-	ProvisionModeReady     = "ready"
+	HookPreStart   = "preStart"
+	HookPostStart  = "postStart"
+	HookPreStop    = "preStop"
+	HookPostStop   = "postStop"
+	HookPostDelete = "postDelete"
 )
 
-type Provision struct {
-	Mode   string `yaml:"mode"`
-	Script string `yaml:"script"`
+// Hooks are shell commands executed on the host at lifecycle events.
+type Hooks struct {
+	PreStart   []string `yaml:"preStart,omitempty"`
+	PostStart  []string `yaml:"postStart,omitempty"`
+	PreStop    []string `yaml:"preStop,omitempty"`
+	PostStop   []string `yaml:"postStop,omitempty"`
+	PostDelete []string `yaml:"postDelete,omitempty"`
 }
 
-// IsColimaMode returns true if the provision script is managed by Colima
-// rather than being passed to Lima.
-func (p Provision) IsColimaMode() bool {
-	return p.Mode == ProvisionModeAfterBoot || p.Mode == ProvisionModeReady
+// Event returns the hooks for the event.
+func (h Hooks) Event(event string) []string {
+	switch event {
+	case HookPreStart:
+		return h.PreStart
+	case HookPostStart:
+		return h.PostStart
+	case HookPreStop:
+		return h.PreStop
+	case HookPostStop:
+		return h.PostStop
+	case HookPostDelete:
+		return h.PostDelete
+	}
+	return nil
 }
 
 func (c Config) MountsOrDefault() []Mount {
@@ -4,17 +4,22 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/abiosoft/colima/util/yamlutil"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 // Save saves the config.
 func Save(c config.Config) error {
-	return yamlutil.Save(c, config.CurrentProfile().File())
+	return SaveToFile(c, config.CurrentProfile().File())
 }
 
 // SaveFromFile loads configuration from file and save as config.
@@ -26,29 +31,115 @@ func SaveFromFile(file string) error {
 	return Save(c)
 }
 
-// SaveToFile saves configuration to file.
+// SaveToFile saves configuration to file in the current config version.
+// Values with expanded variables are saved in their original form, unless changed.
+// Configs extending another config are saved with only the values that differ, see saveExtended.
 func SaveToFile(c config.Config, file string) error {
+	c.Version = CurrentVersion
+	if len(c.Interpolated) > 0 {
+		var err error
+		if c, err = uninterpolated(c); err != nil {
+			return err
+		}
+	}
+	if c.Extends != "" {
+		return saveExtended(c, file)
+	}
 	return yamlutil.Save(c, file)
 }
 
 // LoadFrom loads config from file.
+// Config files of older versions are migrated, see migrations.
+// Variables are expanded, see interpolatedPaths.
 func LoadFrom(file string) (config.Config, error) {
+	return loadFrom(file, true, true)
+}
+
+// loadFrom loads config from file, variables are only expanded if expand.
+func loadFrom(file string, warn, expand bool) (config.Config, error) {
 	var c config.Config
 	b, err := os.ReadFile(file)
 	if err != nil {
 		return c, fmt.Errorf("could not load config from file: %w", err)
 	}
 
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return c, fmt.Errorf("could not load config from file: %w", err)
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	version := values["version"]
+	changes, err := Migrate(values)
+	if err != nil {
+		return c, fmt.Errorf("could not load config from file '%s': %w", file, err)
+	}
+	if warn {
+		warnMigrated(file, changes)
+	}
+	var interpolated []config.Interpolated
+	if expand {
+		if interpolated, err = interpolate(values, filepath.Dir(file)); err != nil {
+			return c, fmt.Errorf("could not load config from file: %w", err)
+		}
+	}
+	if len(interpolated) > 0 || values["version"] != version {
+		if b, err = yaml.Marshal(values); err != nil {
+			return c, fmt.Errorf("could not load config from file: %w", err)
+		}
+	}
+
 	err = yaml.Unmarshal(b, &c)
 	if err != nil {
 		return c, fmt.Errorf("could not load config from file: %w", err)
 	}
+	c.Interpolated = interpolated
 
 	return c, nil
 }
 
-// ValidateConfig validates config before we use it
-func ValidateConfig(c config.Config) error {
+// warnMigrated warns about the changes made to a config file of an older version.
+func warnMigrated(file string, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	logrus.Warnf("config file '%s' is of an older version and has been upgraded:", file)
+	for _, change := range changes {
+		logrus.Warnln("  - " + change)
+	}
+	logrus.Warnln("run 'colima config migrate' to update the file")
+}
+
+// uninterpolated returns the config with the original form of the values with expanded variables.
+func uninterpolated(c config.Config) (config.Config, error) {
+	var values map[string]any
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return c, fmt.Errorf("error encoding config: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return c, fmt.Errorf("error decoding config: %w", err)
+	}
+
+	restoreInterpolated(values, c.Interpolated)
+
+	var raw config.Config
+	if b, err = yaml.Marshal(values); err != nil {
+		return c, fmt.Errorf("error encoding config: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return c, fmt.Errorf("error decoding config: %w", err)
+	}
+	return raw, nil
+}
+
+// ValidateConfig validates config before we use it.
+// Host-aware rules are only checked if host is not nil.
+// All problems are reported as ValidationErrors.
+func ValidateConfig(c config.Config, host *Host) error {
+	var errs ValidationErrors
+
 	validMountTypes := map[string]bool{"9p": true, "sshfs": true}
 	validPortForwarders := map[string]bool{"grpc": true, "ssh": true, "none": true}
 
@@ -56,7 +147,7 @@ func ValidateConfig(c config.Config) error {
 		validMountTypes["virtiofs"] = true
 	}
 	if _, ok := validMountTypes[c.MountType]; !ok {
-		return fmt.Errorf("invalid mountType: '%s'", c.MountType)
+		errs.add("mountType", fmt.Errorf("invalid mountType: '%s'", c.MountType))
 	}
 	validVMTypes := map[string]bool{"qemu": true}
 	if util.MacOS13OrNewer() {
@@ -66,46 +157,54 @@ func ValidateConfig(c config.Config) error {
 		validVMTypes["krunkit"] = true
 	}
 	if c.VMType == "krunkit" && !util.MacOS13OrNewerOnArm() {
-		return fmt.Errorf("vmType 'krunkit' is only available on macOS with Apple Silicon")
-	}
-	if _, ok := validVMTypes[c.VMType]; !ok {
-		return fmt.Errorf("invalid vmType: '%s'", c.VMType)
-	}
-	if c.VMType == "qemu" {
+		errs.add("vmType", fmt.Errorf("vmType 'krunkit' is only available on macOS with Apple Silicon"))
+	} else if _, ok := validVMTypes[c.VMType]; !ok {
+		errs.add("vmType", fmt.Errorf("invalid vmType: '%s'", c.VMType))
+	} else if c.VMType == "qemu" {
 		if err := util.AssertQemuImg(); err != nil {
-			return fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err)
+			errs.add("vmType", fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err))
 		}
-	}
-	if c.VMType == "krunkit" {
+	} else if c.VMType == "krunkit" {
 		if err := util.AssertKrunkit(); err != nil {
-			return fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err)
+			errs.add("vmType", fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err))
 		}
 	}
 
 	if c.DiskImage != "" {
 		if strings.HasPrefix(c.DiskImage, "http://") || strings.HasPrefix(c.DiskImage, "https://") {
-			return fmt.Errorf("cannot use diskImage: remote URLs not supported, only local files can be specified")
+			errs.add("diskImage", fmt.Errorf("cannot use diskImage: remote URLs not supported, only local files can be specified"))
 		}
 	}
 
 	if _, ok := validPortForwarders[c.PortForwarder]; !ok {
-		return fmt.Errorf("invalid port forwarder: '%s'", c.PortForwarder)
+		errs.add("portForwarder", fmt.Errorf("invalid port forwarder: '%s'", c.PortForwarder))
 	}
 
 	if c.Network.GatewayAddress != nil {
 		if err := validateGatewayAddress(c.Network.GatewayAddress); err != nil {
-			return err
+			errs.add("network.gatewayAddress", err)
 		}
 	}
 
-	if err := validateMounts(c.Mounts); err != nil {
-		return err
+	errs = append(errs, validateMounts(c.Mounts)...)
+	errs = append(errs, validateDisks(c.Disks)...)
+	errs = append(errs, validateProvision(c)...)
+	errs = append(errs, validateCombinations(c)...)
+	if host != nil {
+		errs = append(errs, host.validate(c)...)
 	}
 
-	return nil
+	if c.AutoStop.IdleMinutes < 0 {
+		errs.add("autoStop.idleMinutes", fmt.Errorf("invalid autoStop.idleMinutes: %d", c.AutoStop.IdleMinutes))
+	}
+	if c.Drain.Timeout < 0 {
+		errs.add("drain.timeout", fmt.Errorf("invalid drain.timeout: %d", c.Drain.Timeout))
+	}
+
+	return errs.err()
 }
 
-// Load loads the config.
+// Load loads the config, merged with the configs it extends.
 // Error is only returned if the config file exists but could not be loaded.
 // No error is returned if the config file does not exist.
 func Load() (c config.Config, err error) {
@@ -114,12 +213,64 @@ func Load() (c config.Config, err error) {
 		return c, nil
 	}
 
-	return LoadFrom(f)
+	return LoadResolved(f)
+}
+
+// LoadResolved is like LoadFrom but merges the config with the configs it extends.
+func LoadResolved(file string) (config.Config, error) {
+	layers, err := LoadLayers(Layer{Name: LayerProfile, File: file})
+	if err != nil {
+		return config.Config{}, err
+	}
+	if len(layers) == 0 {
+		return config.Config{}, fmt.Errorf("could not load config from file: '%s' not found", file)
+	}
+	return layers.Config()
 }
 
 // LoadInstance is like Load but returns the config of the currently running instance.
 func LoadInstance() (config.Config, error) {
-	return LoadFrom(config.CurrentProfile().StateFile())
+	return LoadState(config.CurrentProfile().StateFile())
+}
+
+// LoadState loads the state file of an instance.
+// A corrupted state file is recovered from its backup, see SaveState.
+func LoadState(file string) (config.Config, error) {
+	c, err := loadState(file)
+	if err == nil {
+		return c, nil
+	}
+	if _, statErr := os.Stat(file); statErr != nil {
+		return c, err
+	}
+
+	backup, backupErr := loadState(fsutil.BackupFile(file))
+	if backupErr != nil {
+		return c, err
+	}
+	logrus.Warnln(fmt.Errorf("state file '%s' is corrupted, using the previous state: %w", file, err))
+	return backup, nil
+}
+
+// loadState loads the state file without expanding variables, the values are saved expanded.
+func loadState(file string) (config.Config, error) { return loadFrom(file, true, false) }
+
+// SaveState saves the config as the state file of an instance.
+// The state is saved resolved, independent of the configs the config extends,
+// and with the expanded values of variables, independent of the environment.
+// The previous state is kept as a backup to recover from corruption.
+func SaveState(c config.Config, file string) error {
+	c.Extends = ""
+	c.ListMerge = ""
+	c.Interpolated = nil
+
+	// a corrupted state must not replace the backup
+	if _, err := loadState(file); err == nil {
+		if err := fsutil.Backup(file); err != nil {
+			logrus.Debugln(err)
+		}
+	}
+	return SaveToFile(c, file)
 }
 
 // Teardown deletes the config.
@@ -147,16 +298,181 @@ func validateGatewayAddress(gateway net.IP) error {
 	return nil
 }
 
+// validateProvision validates the provision scripts and their dependencies.
+func validateProvision(c config.Config) ValidationErrors {
+	var errs ValidationErrors
+
+	names := map[string]bool{}
+	for i, p := range c.Provision {
+		key := "provision." + strconv.Itoa(i)
+		if p.Name != "" {
+			if names[p.Name] {
+				errs.add(key+".name", fmt.Errorf("duplicate provision script name: '%s'", p.Name))
+			}
+			names[p.Name] = true
+		}
+
+		if !p.IsColimaMode() {
+			if p.Once || p.Timeout != "" || p.OnFailure != "" || len(p.DependsOn) > 0 {
+				errs.add(key, fmt.Errorf("provision script mode '%s' does not support once, timeout, onFailure and dependsOn, only %s and %s modes do",
+					p.Mode, config.ProvisionModeAfterBoot, config.ProvisionModeReady))
+			}
+			continue
+		}
+
+		switch p.OnFailure {
+		case "", config.ProvisionOnFailureWarn, config.ProvisionOnFailureAbort:
+		default:
+			errs.add(key+".onFailure", fmt.Errorf("invalid provision script onFailure: '%s'", p.OnFailure))
+		}
+		if _, err := p.TimeoutDuration(); err != nil {
+			errs.add(key+".timeout", fmt.Errorf("invalid provision script: %w", err))
+		}
+	}
+
+	// dependencies are only meaningful with unique names
+	if len(errs) > 0 {
+		return errs
+	}
+	for _, mode := range []string{config.ProvisionModeAfterBoot, config.ProvisionModeReady} {
+		if _, err := c.ProvisionScripts(mode); err != nil {
+			errs.add("provision", err)
+		}
+	}
+
+	return errs
+}
+
+// validateCombinations validates the values that depend on other values.
+func validateCombinations(c config.Config) ValidationErrors {
+	var errs ValidationErrors
+
+	switch {
+	case c.MountType == "virtiofs" && c.VMType == "qemu":
+		errs.addHint("mountType", fmt.Errorf("mountType 'virtiofs' is not supported by vmType 'qemu'"),
+			"set mountType to sshfs or 9p, or set vmType to vz")
+	case c.MountType == "9p" && (c.VMType == "vz" || c.VMType == "krunkit"):
+		errs.addHint("mountType", fmt.Errorf("mountType '9p' is not supported by vmType '%s'", c.VMType),
+			"set mountType to virtiofs or sshfs")
+	}
+
+	if c.RootDisk > 0 && c.Disk > 0 && c.RootDisk >= c.Disk {
+		errs.addHint("rootDisk", fmt.Errorf("rootDisk (%dGiB) must be smaller than disk (%dGiB)", c.RootDisk, c.Disk),
+			"the disk holds the container data, increase disk or reduce rootDisk")
+	}
+
+	if c.VZRosetta && c.VMType != "vz" {
+		errs.addHint("rosetta", fmt.Errorf("rosetta is only available for vmType 'vz'"),
+			"set vmType to vz or disable rosetta")
+	}
+
+	if c.Network.PreferredRoute && !c.Network.Address {
+		errs.addHint("network.preferredRoute", fmt.Errorf("network.preferredRoute requires a reachable IP address"),
+			"enable network.address or disable network.preferredRoute")
+	}
+
+	if c.Kubernetes.Enabled && c.Runtime == "incus" {
+		errs.addHint("kubernetes.enabled", fmt.Errorf("kubernetes is not supported with runtime 'incus'"),
+			"disable kubernetes or use the docker or containerd runtime")
+	}
+
+	return errs
+}
+
 // validateMounts ensures mount paths do not contain spaces, which are not
 // supported by the underlying Lima runtime and otherwise fail silently.
 // See https://github.com/abiosoft/colima/issues/1471.
-func validateMounts(mounts []config.Mount) error {
-	for _, m := range mounts {
-		for _, p := range []string{m.Location, m.MountPoint} {
-			if strings.Contains(p, " ") {
-				return fmt.Errorf("mount path with spaces is not supported by the underlying Lima runtime: %q", p)
+func validateMounts(mounts []config.Mount) ValidationErrors {
+	var errs ValidationErrors
+	for i, m := range mounts {
+		for _, p := range [][2]string{{"location", m.Location}, {"mountPoint", m.MountPoint}} {
+			if strings.Contains(p[1], " ") {
+				errs.add("mounts."+strconv.Itoa(i)+"."+p[0], fmt.Errorf("mount path with spaces is not supported by the underlying Lima runtime: %q", p[1]))
 			}
 		}
 	}
-	return nil
+	return errs
+}
+
+var diskName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// validateDisks validates the data disks, their names and mount points must be unique.
+func validateDisks(disks []config.DataDisk) ValidationErrors {
+	var errs ValidationErrors
+
+	names := map[string]bool{}
+	mountPoints := map[string]bool{}
+	for i, d := range disks {
+		key := "disks." + strconv.Itoa(i)
+
+		if !diskName.MatchString(d.Name) {
+			errs.add(key+".name", fmt.Errorf("invalid disk name: '%s', only letters, digits, '.', '_' and '-' are allowed", d.Name))
+		} else if names[d.Name] {
+			errs.add(key+".name", fmt.Errorf("duplicate disk name: '%s'", d.Name))
+		}
+		names[d.Name] = true
+
+		if d.Size <= 0 {
+			errs.add(key+".size", fmt.Errorf("invalid disk size: %d", d.Size))
+		}
+
+		switch d.FSTypeOrDefault() {
+		case "ext4", "xfs", "btrfs":
+		default:
+			errs.add(key+".fsType", fmt.Errorf("invalid disk fsType: '%s'", d.FSType))
+		}
+
+		mountPoint := d.MountPointOrDefault()
+		switch {
+		case !filepath.IsAbs(mountPoint):
+			errs.add(key+".mountPoint", fmt.Errorf("disk mount point must be an absolute path: '%s'", mountPoint))
+		case strings.Contains(mountPoint, " "):
+			errs.add(key+".mountPoint", fmt.Errorf("disk mount point with spaces is not supported: %q", mountPoint))
+		case mountPoints[filepath.Clean(mountPoint)]:
+			errs.add(key+".mountPoint", fmt.Errorf("duplicate disk mount point: '%s'", mountPoint))
+		default:
+			if dir, ok := reservedMountPoint(mountPoint); ok {
+				errs.add(key+".mountPoint", fmt.Errorf("disk mount point '%s' overlaps reserved directory '%s'", mountPoint, dir))
+			}
+		}
+		mountPoints[filepath.Clean(mountPoint)] = true
+	}
+
+	return errs
+}
+
+// reservedDirs are the directories of the VM managed by colima and lima,
+// including the data directories of the container runtimes mounted from the runtime disk.
+var reservedDirs = []string{
+	"/var/lib/docker",
+	"/var/lib/containerd",
+	"/var/lib/buildkit",
+	"/var/lib/nerdctl",
+	"/var/lib/rancher",
+	"/var/lib/cni",
+	"/var/lib/ramalama",
+	"/var/lib/incus",
+	"/mnt/lima-cidata",
+}
+
+// reservedMountPoint returns the reserved directory the mount point is in or contains, if any.
+// Directories prefixed with lima- in /mnt are reserved for the runtime disk.
+func reservedMountPoint(mountPoint string) (string, bool) {
+	mountPoint = filepath.Clean(mountPoint)
+	within := func(dir, parent string) bool {
+		return parent == "/" || dir == parent || strings.HasPrefix(dir, parent+"/")
+	}
+
+	for _, dir := range reservedDirs {
+		if within(mountPoint, dir) || within(dir, mountPoint) {
+			return dir, true
+		}
+	}
+	if within(mountPoint, "/mnt") && mountPoint != "/mnt" {
+		dir := strings.SplitN(strings.TrimPrefix(mountPoint, "/mnt/"), "/", 2)[0]
+		if strings.HasPrefix(dir, "lima-") {
+			return "/mnt/" + dir, true
+		}
+	}
+	return "", false
 }
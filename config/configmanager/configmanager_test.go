@@ -1,9 +1,16 @@
 package configmanager
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"gopkg.in/yaml.v3"
 )
 
 func TestValidateMounts(t *testing.T) {
@@ -26,3 +33,916 @@ func TestValidateMounts(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateDisks(t *testing.T) {
+	tests := []struct {
+		name    string
+		disks   []config.DataDisk
+		wantErr bool
+	}{
+		{name: "empty", disks: nil, wantErr: false},
+		{name: "valid", disks: []config.DataDisk{{Name: "db", Size: 20}, {Name: "cache", Size: 5, FSType: "xfs", MountPoint: "/var/cache/app"}}, wantErr: false},
+		{name: "invalid name", disks: []config.DataDisk{{Name: "my disk", Size: 20}}, wantErr: true},
+		{name: "duplicate name", disks: []config.DataDisk{{Name: "db", Size: 20}, {Name: "db", Size: 5, MountPoint: "/data"}}, wantErr: true},
+		{name: "missing size", disks: []config.DataDisk{{Name: "db"}}, wantErr: true},
+		{name: "invalid fsType", disks: []config.DataDisk{{Name: "db", Size: 20, FSType: "ntfs"}}, wantErr: true},
+		{name: "relative mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "data"}}, wantErr: true},
+		{name: "duplicate mount point", disks: []config.DataDisk{{Name: "a", Size: 1, MountPoint: "/data"}, {Name: "b", Size: 1, MountPoint: "/data/"}}, wantErr: true},
+		{name: "runtime mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "/var/lib/docker"}}, wantErr: true},
+		{name: "within runtime mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "/var/lib/containerd/io"}}, wantErr: true},
+		{name: "over runtime mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "/var/lib"}}, wantErr: true},
+		{name: "root mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "/"}}, wantErr: true},
+		{name: "runtime disk mount point", disks: []config.DataDisk{{Name: "lima-colima", Size: 20}}, wantErr: true},
+		{name: "similar mount point", disks: []config.DataDisk{{Name: "db", Size: 20, MountPoint: "/var/lib/dockerdata"}}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDisks(tt.disks); (err != nil) != tt.wantErr {
+				t.Errorf("validateDisks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProvision(t *testing.T) {
+	tests := []struct {
+		name      string
+		provision []config.Provision
+		wantErr   bool
+	}{
+		{name: "empty", provision: nil, wantErr: false},
+		{name: "lima mode", provision: []config.Provision{{Mode: "system", Script: "true"}}, wantErr: false},
+		{name: "lima mode with once", provision: []config.Provision{{Mode: "system", Script: "true", Once: true}}, wantErr: true},
+		{name: "all options", provision: []config.Provision{
+			{Mode: config.ProvisionModeAfterBoot, Name: "a", Once: true, Timeout: "5m", OnFailure: "abort"},
+			{Mode: config.ProvisionModeReady, Name: "b", DependsOn: []string{"a"}},
+		}, wantErr: false},
+		{name: "invalid timeout", provision: []config.Provision{{Mode: config.ProvisionModeReady, Timeout: "5"}}, wantErr: true},
+		{name: "invalid onFailure", provision: []config.Provision{{Mode: config.ProvisionModeReady, OnFailure: "ignore"}}, wantErr: true},
+		{name: "duplicate name", provision: []config.Provision{
+			{Mode: config.ProvisionModeReady, Name: "a"},
+			{Mode: config.ProvisionModeReady, Name: "a"},
+		}, wantErr: true},
+		{name: "unknown dependency", provision: []config.Provision{{Mode: config.ProvisionModeReady, DependsOn: []string{"a"}}}, wantErr: true},
+		{name: "later mode dependency", provision: []config.Provision{
+			{Mode: config.ProvisionModeAfterBoot, Name: "a", DependsOn: []string{"b"}},
+			{Mode: config.ProvisionModeReady, Name: "b"},
+		}, wantErr: true},
+		{name: "circular dependency", provision: []config.Provision{
+			{Mode: config.ProvisionModeReady, Name: "a", DependsOn: []string{"b"}},
+			{Mode: config.ProvisionModeReady, Name: "b", DependsOn: []string{"a"}},
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateProvision(config.Config{Provision: tt.provision}); (err != nil) != tt.wantErr {
+				t.Errorf("validateProvision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNode(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		keys []string
+	}{
+		{name: "valid", yaml: "cpu: 2\nmemory: 2.5\nhostname: null\nnetwork:\n  dns: [1.1.1.1]\n"},
+		{name: "unknown key", yaml: "cpus: 2\nnetwork:\n  adress: true\n", keys: []string{"cpus", "network.adress"}},
+		{name: "wrong type", yaml: "cpu: two\nmounts: ~/projects\n", keys: []string{"cpu", "mounts"}},
+		{name: "invalid enum", yaml: "vmType: kvm\nprovision:\n  - mode: boot\n    script: true\n", keys: []string{"vmType", "provision.0.mode"}},
+		{name: "map values", yaml: "env:\n  KEY: [a]\ndocker:\n  debug: true\n", keys: []string{"env.KEY"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			var errs ValidationErrors
+			validateNode("", doc.Content[0], schema, &errs)
+
+			var keys []string
+			for _, e := range errs {
+				if e.Line == 0 {
+					t.Errorf("missing line for %s", e.Key)
+				}
+				keys = append(keys, e.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("expected errors for %v, got %v", tt.keys, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		yaml  string
+		keys  []string
+		lines []int
+	}{
+		{name: "current", yaml: "version: 1\ncpu: 2\n"},
+		{name: "current typo", yaml: "version: 1\ncpus: 2\n", keys: []string{"cpus"}, lines: []int{2}},
+		{name: "unversioned", yaml: "activate: false\nkubernetes:\n  disable: [traefik]\n"},
+		{name: "unversioned typo", yaml: "activate: false\ncpus: 2\n", keys: []string{"cpus"}, lines: []int{2}},
+		{name: "unversioned wrong type", yaml: "kubernetes:\n  disable: [traefik]\n  enabled: [true]\n",
+			keys: []string{"kubernetes.enabled"}, lines: []int{3}},
+		{name: "newer version", yaml: "version: 100\n", keys: []string{"version"}, lines: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			errs := validateSchema(doc.Content[0], schema)
+			locateErrors(errs, doc.Content[0])
+
+			var keys []string
+			var lines []int
+			for _, e := range errs {
+				keys = append(keys, e.Key)
+				lines = append(lines, e.Line)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("expected errors for %v at lines %v, got %v", tt.keys, tt.lines, errs)
+			}
+		})
+	}
+}
+
+func TestSetValueLegacy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "colima.yaml")
+	legacy := "cpu: 2\nactivate: false\nkubernetes:\n  ingress: false\n"
+	if err := os.WriteFile(file, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetValue(file, "memory", "4"); err != nil {
+		t.Fatalf("expected legacy keys to be migrated before validation, got %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := legacy + "memory: 4\n"; string(b) != want {
+		t.Errorf("unexpected config file\n%s\nwant\n%s", b, want)
+	}
+
+	// the problems of the migrated values are reported at their position in the file
+	if err := os.WriteFile(file, []byte(legacy+"disk: large\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = SetValue(file, "memory", "4")
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Key != "disk" || errs[0].Line != 5 {
+		t.Errorf("expected disk error at line 5, got %#v", err)
+	}
+}
+
+func TestDefaultConfigSchema(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := embedded.Read("defaults/colima.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs ValidationErrors
+	validateNode("", doc.Content[0], schema, &errs)
+	if len(errs) > 0 {
+		t.Errorf("default config does not match schema: %v", errs)
+	}
+	if d := schema.Properties["cpu"].Description; d != "Number of CPUs to be allocated to the virtual machine." {
+		t.Errorf("unexpected description for cpu: %q", d)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	layers, err := LoadLayers(
+		Layer{Name: LayerTemplate, File: write("template.yaml", "cpu: 4\nmemory: 8\nenv:\n  A: template\n  B: template\nmounts:\n  - location: /a\n")},
+		Layer{Name: LayerProfile, File: write("profile.yaml", "cpu: 2\nhostname: null\nenv:\n  B: profile\n")},
+		Layer{Name: LayerProject, File: filepath.Join(dir, "missing.yaml")},
+		Layer{Name: LayerProject, File: write("project.yaml", "mounts:\n  - location: /b\n")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := layers.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CPU != 2 || c.Memory != 8 {
+		t.Errorf("unexpected cpu and memory: %d, %v", c.CPU, c.Memory)
+	}
+	if want := map[string]string{"A": "template", "B": "profile"}; !reflect.DeepEqual(c.Env, want) {
+		t.Errorf("expected env %v, got %v", want, c.Env)
+	}
+	if len(c.Mounts) != 1 || c.Mounts[0].Location != "/b" {
+		t.Errorf("expected project mounts, got %v", c.Mounts)
+	}
+
+	c, err = layers.Without(LayerProject).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Mounts) != 1 || c.Mounts[0].Location != "/a" {
+		t.Errorf("expected template mounts, got %v", c.Mounts)
+	}
+
+	var origins []string
+	for _, v := range layers.Lookup("cpu") {
+		origins = append(origins, v.Layer.Name)
+	}
+	if want := []string{LayerTemplate, LayerProfile}; !reflect.DeepEqual(origins, want) {
+		t.Errorf("expected cpu to be set by %v, got %v", want, origins)
+	}
+	if v := layers.Lookup("hostname"); len(v) != 0 {
+		t.Errorf("expected null hostname to be unset, got %v", v)
+	}
+
+	for _, tt := range []struct{ name, content string }{
+		{name: "hooks.yaml", content: "hooks:\n  preStart: [echo]\n"},
+		{name: "hooks-extends.yaml", content: "extends: ./hooks.yaml\n"},
+		{name: "bad-extends.yaml", content: "extends: ./missing-base.yaml\n"},
+		{name: "invalid-yaml.yaml", content: "cpu: [\n"},
+		{name: "newer-version.yaml", content: "version: 100\n"},
+	} {
+		name, file := tt.name, write(tt.name, tt.content)
+		_, err = LoadLayers(Layer{Name: LayerProfile, File: write("valid.yaml", "cpu: 2\n")}, Layer{Name: LayerProject, File: file})
+		var projectErr ProjectConfigError
+		if !errors.As(err, &projectErr) || projectErr.File != file {
+			t.Errorf("expected project config error for %s, got %v", name, err)
+		}
+	}
+
+	// variables are not expanded in project configs and the configs they extend
+	t.Setenv("COLIMA_TEST_TOKEN", "secret")
+	write("secret", "secret")
+	write("project-base.yaml", "env:\n  FILE: ${file:./secret}\n")
+	project := write("project-vars.yaml", "extends: ./project-base.yaml\nenv:\n  TOKEN: ${COLIMA_TEST_TOKEN}\n")
+	layers, err = LoadLayers(Layer{Name: LayerProject, File: project})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = layers.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"FILE": "${file:./secret}", "TOKEN": "${COLIMA_TEST_TOKEN}"}; !reflect.DeepEqual(c.Env, want) {
+		t.Errorf("expected project env %v, got %v", want, c.Env)
+	}
+}
+
+func TestLayersOverride(t *testing.T) {
+	lower := "cpu: 4\nhostname: lower\nenv:\n  A: a\n  B: b\ndocker:\n  features:\n    buildkit: true\nnetwork:\n  dnsHosts:\n    a.local: 1.2.3.4\n"
+	tests := []struct {
+		name   string
+		higher string
+		want   func(c config.Config) bool
+	}{
+		{name: "scalar", higher: "cpu: 2\n", want: func(c config.Config) bool { return c.CPU == 2 }},
+		{name: "null scalar", higher: "hostname: null\n", want: func(c config.Config) bool { return c.Hostname == "lower" }},
+		{name: "map keys merged", higher: "env:\n  C: c\n", want: func(c config.Config) bool {
+			return reflect.DeepEqual(c.Env, map[string]string{"A": "a", "B": "b", "C": "c"})
+		}},
+		{name: "map key replaced", higher: "env:\n  A: x\n", want: func(c config.Config) bool {
+			return reflect.DeepEqual(c.Env, map[string]string{"A": "x", "B": "b"})
+		}},
+		{name: "map key removed", higher: "env:\n  A: null\n", want: func(c config.Config) bool {
+			return reflect.DeepEqual(c.Env, map[string]string{"B": "b"})
+		}},
+		{name: "null map", higher: "env: null\n", want: func(c config.Config) bool { return len(c.Env) == 2 }},
+		{name: "nested map key removed", higher: "docker:\n  features:\n    buildkit: null\n", want: func(c config.Config) bool {
+			return reflect.DeepEqual(c.Docker, map[string]any{"features": map[string]any{}})
+		}},
+		{name: "dns host removed", higher: "network:\n  dnsHosts:\n    a.local: null\n", want: func(c config.Config) bool {
+			return len(c.Network.DNSHosts) == 0
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range map[string]string{"lower.yaml": lower, "higher.yaml": tt.higher} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			layers, err := LoadLayers(
+				Layer{Name: LayerTemplate, File: filepath.Join(dir, "lower.yaml")},
+				Layer{Name: LayerProfile, File: filepath.Join(dir, "higher.yaml")},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := layers.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want(c) {
+				t.Errorf("unexpected config: cpu %d, hostname %q, env %v, docker %v, dnsHosts %v",
+					c.CPU, c.Hostname, c.Env, c.Docker, c.Network.DNSHosts)
+			}
+		})
+	}
+}
+
+func TestExtends(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	write("base.yaml", "cpu: 4\nmemory: 8\nenv:\n  A: base\nmounts:\n  - location: /a\n")
+	write("team.yaml", "extends: ./base.yaml\nenv:\n  B: team\n")
+	profile := write("profile.yaml", "extends: ./team.yaml\nlistMerge: append\ncpu: 2\nmounts:\n  - location: /a\n  - location: /b\n")
+
+	layers, err := LoadLayers(Layer{Name: LayerProfile, File: profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range layers {
+		names = append(names, l.Name)
+	}
+	if want := []string{LayerExtends, LayerExtends, LayerProfile}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected layers %v, got %v", want, names)
+	}
+
+	c, err := layers.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CPU != 2 || c.Memory != 8 {
+		t.Errorf("unexpected cpu and memory: %d, %v", c.CPU, c.Memory)
+	}
+	if want := map[string]string{"A": "base", "B": "team"}; !reflect.DeepEqual(c.Env, want) {
+		t.Errorf("expected env %v, got %v", want, c.Env)
+	}
+	if len(c.Mounts) != 2 || c.Mounts[0].Location != "/a" || c.Mounts[1].Location != "/b" {
+		t.Errorf("expected appended mounts without duplicates, got %v", c.Mounts)
+	}
+
+	write("cycle.yaml", "extends: ./profile-cycle.yaml\n")
+	cycle := write("profile-cycle.yaml", "extends: ./cycle.yaml\n")
+	if _, err := LoadLayers(Layer{Name: LayerProfile, File: cycle}); err == nil {
+		t.Errorf("expected error for circular extends")
+	}
+	missing := write("missing.yaml", "extends: ./none.yaml\n")
+	if _, err := LoadLayers(Layer{Name: LayerProfile, File: missing}); err == nil {
+		t.Errorf("expected error for missing extended config")
+	}
+	project := write("project.yaml", "extends: ./hooks.yaml\n")
+	write("hooks.yaml", "hooks:\n  preStart: [echo]\n")
+	if _, err := LoadLayers(Layer{Name: LayerProject, File: project}); err == nil {
+		t.Errorf("expected error for hooks extended by project config")
+	}
+}
+
+func TestSaveExtended(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	if err := os.WriteFile(base, []byte("cpu: 4\nmemory: 8\nenv:\n  A: base\n  B: base\nmounts:\n  - location: /a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "profile.yaml")
+	if err := os.WriteFile(file, []byte("extends: ./base.yaml\nlistMerge: append\n# memory of the profile\nmemory: 4\nenv:\n  C: profile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadResolved(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Memory = 6
+	c.Mounts = append(c.Mounts, config.Mount{Location: "/b"})
+	delete(c.Env, "A")
+	delete(c.Env, "C")
+	if err := SaveToFile(c, file); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["cpu"]; ok {
+		t.Errorf("inherited cpu saved to the profile\n%s", b)
+	}
+	if values["memory"] != 6 || values["version"] != CurrentVersion {
+		t.Errorf("expected memory and version in the profile\n%s", b)
+	}
+	if mounts, _ := values["mounts"].([]any); len(mounts) != 1 {
+		t.Errorf("expected only the appended mount in the profile\n%s", b)
+	}
+	if env, _ := values["env"].(map[string]any); !reflect.DeepEqual(env, map[string]any{"A": nil}) {
+		t.Errorf("expected the removed inherited env to be null in the profile\n%s", b)
+	}
+	if !strings.Contains(string(b), "# memory of the profile") {
+		t.Errorf("comments not retained\n%s", b)
+	}
+
+	c, err = LoadResolved(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CPU != 4 || c.Memory != 6 || len(c.Mounts) != 2 {
+		t.Errorf("unexpected config after save: %d, %v, %v", c.CPU, c.Memory, c.Mounts)
+	}
+	if want := map[string]string{"B": "base"}; !reflect.DeepEqual(c.Env, want) {
+		t.Errorf("expected env %v after save, got %v", want, c.Env)
+	}
+}
+
+func TestSaveStateExtended(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("cpu: 4\nmemory: 8\nruntime: docker\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "profile.yaml")
+	if err := os.WriteFile(file, []byte("extends: ./base.yaml\nlistMerge: append\nmemory: 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadResolved(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state file is elsewhere, the extended config is not resolvable from it
+	state := filepath.Join(t.TempDir(), "colima.yaml")
+	if err := SaveState(c, state); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Extends != "" || s.ListMerge != "" {
+		t.Errorf("expected state without extends, got %q, %q", s.Extends, s.ListMerge)
+	}
+	if s.CPU != 4 || s.Memory != 4 || s.Runtime != "docker" {
+		t.Errorf("expected resolved state, got %d, %v, %s", s.CPU, s.Memory, s.Runtime)
+	}
+}
+
+func TestSaveStateInterpolated(t *testing.T) {
+	t.Setenv("COLIMA_TEST_TOKEN", "secret")
+	file := filepath.Join(t.TempDir(), "colima.yaml")
+	if err := os.WriteFile(file, []byte("env:\n  TOKEN: ${COLIMA_TEST_TOKEN}\n  ESCAPED: $${HOME}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadFrom(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := filepath.Join(t.TempDir(), "colima.yaml")
+	if err := SaveState(c, state); err != nil {
+		t.Fatal(err)
+	}
+	// the state is loaded without the variables e.g. by the autostop daemon
+	os.Unsetenv("COLIMA_TEST_TOKEN")
+	for i := 0; i < 2; i++ {
+		s, err := LoadState(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Env["TOKEN"] != "secret" || s.Env["ESCAPED"] != "${HOME}" {
+			t.Errorf("expected expanded state, got %v", s.Env)
+		}
+		// saved again with a backup
+		if err := SaveState(s, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(state + ".bak"); err != nil {
+		t.Errorf("expected backup of the state file: %v", err)
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindProjectFile(nested); got != "" {
+		t.Errorf("expected no project file, got %s", got)
+	}
+
+	file := filepath.Join(dir, "a", ProjectFileName)
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindProjectFile(nested); got != file {
+		t.Errorf("expected %s, got %s", file, got)
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COLIMA_TEST_VAR", "value")
+	t.Setenv("COLIMA_TEST_EMPTY", "")
+
+	tests := []struct {
+		in      string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${COLIMA_TEST_VAR}", want: "value"},
+		{in: "a-${COLIMA_TEST_VAR}-b", want: "a-value-b"},
+		{in: "${COLIMA_TEST_UNSET:-default}", want: "default"},
+		{in: "${COLIMA_TEST_EMPTY:-default}", want: "default"},
+		{in: "${COLIMA_TEST_EMPTY}", strict: true, want: ""},
+		{in: "${file:token}", want: "secret"},
+		{in: "${file:" + filepath.Join(dir, "token") + "}", want: "secret"},
+		{in: "${file:missing}", wantErr: true},
+		{in: "$${COLIMA_TEST_VAR}", want: "${COLIMA_TEST_VAR}"},
+		{in: "$COLIMA_TEST_VAR", want: "$COLIMA_TEST_VAR"},
+		{in: "${COLIMA_TEST_UNSET}", want: "${COLIMA_TEST_UNSET}"},
+		{in: "${COLIMA_TEST_UNSET}", strict: true, wantErr: true},
+		{in: "${env:COLIMA_TEST_VAR}", want: "value"},
+		{in: "${env:COLIMA_TEST_UNSET:-default}", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandVariables(tt.in, dir, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandVariables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("expandVariables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandScriptVariables(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "setup.sh"), []byte("echo setup\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COLIMA_TEST_VAR", "value")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "echo ${HOME} ${USER:-guest} $PATH", want: "echo ${HOME} ${USER:-guest} $PATH"},
+		{in: "echo ${env:COLIMA_TEST_VAR} ${COLIMA_TEST_VAR}", want: "echo value ${COLIMA_TEST_VAR}"},
+		{in: "${file:setup.sh}", want: "echo setup"},
+		{in: "echo $${env:COLIMA_TEST_VAR} $${HOME}", want: "echo ${env:COLIMA_TEST_VAR} $${HOME}"},
+		{in: "echo ${env:COLIMA_TEST_UNSET}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandScriptVariables(tt.in, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandScriptVariables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("expandScriptVariables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	t.Setenv("COLIMA_TEST_TOKEN", "secret")
+	t.Setenv("COLIMA_TEST_DIR", "/projects")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "colima.yaml")
+	content := `cpu: 2
+hostname: ${COLIMA_TEST_TOKEN}
+env:
+  TOKEN: ${COLIMA_TEST_TOKEN}
+  OTHER: ${COLIMA_TEST_TOKEN}
+docker:
+  proxies:
+    http-proxy: ${COLIMA_TEST_PROXY:-http://proxy:3128}
+mounts:
+  - location: ${COLIMA_TEST_DIR}/app
+    writable: true
+provision:
+  - mode: system
+    script: echo ${env:COLIMA_TEST_TOKEN} ${COLIMA_TEST_TOKEN} ${HOME} ${GUEST_VAR:-guest}
+kubernetes:
+  k3sArgs:
+    - --token=${COLIMA_TEST_TOKEN}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadFrom(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hostname != "${COLIMA_TEST_TOKEN}" {
+		t.Errorf("expected hostname not to be expanded, got %s", c.Hostname)
+	}
+	if c.Env["TOKEN"] != "secret" {
+		t.Errorf("expected env to be expanded, got %s", c.Env["TOKEN"])
+	}
+	if v := c.Docker["proxies"].(map[string]any)["http-proxy"]; v != "http://proxy:3128" {
+		t.Errorf("expected docker to be expanded, got %v", v)
+	}
+	if c.Mounts[0].Location != "/projects/app" {
+		t.Errorf("expected mounts to be expanded, got %s", c.Mounts[0].Location)
+	}
+	if c.Provision[0].Script != "echo secret ${COLIMA_TEST_TOKEN} ${HOME} ${GUEST_VAR:-guest}" {
+		t.Errorf("expected provision to be expanded, got %s", c.Provision[0].Script)
+	}
+	if c.Kubernetes.K3sArgs[0] != "--token=secret" {
+		t.Errorf("expected k3sArgs to be expanded, got %s", c.Kubernetes.K3sArgs[0])
+	}
+
+	// unchanged values are saved in their original form
+	c.Env["OTHER"] = "changed"
+	if err := SaveToFile(c, file); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(b)
+	for _, s := range []string{"TOKEN: ${COLIMA_TEST_TOKEN}", "OTHER: changed", "${COLIMA_TEST_DIR}/app",
+		"${COLIMA_TEST_PROXY:-http://proxy:3128}", "--token=${COLIMA_TEST_TOKEN}", "echo ${env:COLIMA_TEST_TOKEN} ${COLIMA_TEST_TOKEN}"} {
+		if !strings.Contains(saved, s) {
+			t.Errorf("expected saved config to contain %q", s)
+		}
+	}
+	for _, s := range []string{": secret", "=secret", "echo secret"} {
+		if strings.Contains(saved, s) {
+			t.Errorf("expected saved config not to contain expanded value %q", s)
+		}
+	}
+
+	t.Setenv("COLIMA_TEST_TOKEN", "")
+	os.Unsetenv("COLIMA_TEST_TOKEN")
+	if _, err := LoadFrom(file); err == nil {
+		t.Errorf("expected error for undefined variable")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		changes int
+		wantErr bool
+	}{
+		{name: "current", yaml: "version: 1\ncpu: 2\n", want: "cpu: 2\nversion: 1\n"},
+		{name: "unversioned", yaml: "cpu: 2\n", want: "cpu: 2\nversion: 1\n"},
+		{name: "activate", yaml: "activate: false\n", want: "autoActivate: false\nversion: 1\n", changes: 1},
+		{name: "ingress disabled", yaml: "kubernetes:\n  ingress: false\n",
+			want: "kubernetes:\n    k3sArgs:\n        - --disable=traefik\nversion: 1\n", changes: 1},
+		{name: "ingress enabled", yaml: "kubernetes:\n  ingress: true\n",
+			want: "kubernetes:\n    k3sArgs: []\nversion: 1\n", changes: 1},
+		{name: "disable", yaml: "kubernetes:\n  k3sArgs: [--disable=traefik]\n  disable: [traefik, servicelb]\n",
+			want: "kubernetes:\n    k3sArgs:\n        - --disable=traefik\n        - --disable=servicelb\nversion: 1\n", changes: 1},
+		{name: "newer version", yaml: "version: 100\n", wantErr: true},
+		{name: "invalid version", yaml: "version: one\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values map[string]any
+			if err := yaml.Unmarshal([]byte(tt.yaml), &values); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := Migrate(values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Migrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(changes) != tt.changes {
+				t.Errorf("expected %d changes, got %v", tt.changes, changes)
+			}
+			b, _ := yaml.Marshal(values)
+			if string(b) != tt.want {
+				t.Errorf("unexpected migrated config\n%s\nwant\n%s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyValues(t *testing.T) {
+	var c config.Config
+	c.CPU = 2
+	c.Memory = 4
+	c.Kubernetes.K3sArgs = []string{"--disable=traefik"}
+
+	keys, err := MigrateLegacyValues(&c, map[string]any{
+		"cpu":                4,
+		"kubernetes.enabled": true,
+		"kubernetes.disable": []string{"traefik", "servicelb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cpu", "kubernetes.enabled", "kubernetes.k3sArgs"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("MigrateLegacyValues() keys = %v, want %v", keys, want)
+	}
+	if c.CPU != 4 || c.Memory != 4 || !c.Kubernetes.Enabled {
+		t.Errorf("unexpected migrated config %+v", c)
+	}
+	if want := []string{"--disable=traefik", "--disable=servicelb"}; !reflect.DeepEqual(c.Kubernetes.K3sArgs, want) {
+		t.Errorf("expected k3s args %v, got %v", want, c.Kubernetes.K3sArgs)
+	}
+}
+
+func TestDefaultConfigVersion(t *testing.T) {
+	b, err := embedded.Read("defaults/colima.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c config.Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != CurrentVersion {
+		t.Errorf("default config version %d is not the current version %d", c.Version, CurrentVersion)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    []string
+		wantErr bool
+	}{
+		{key: "cpu", want: []string{"cpu"}},
+		{key: "kubernetes.version", want: []string{"kubernetes", "version"}},
+		{key: "network.dnsHosts.host.docker.internal", want: []string{"network", "dnsHosts", "host.docker.internal"}},
+		{key: "env.A", want: []string{"env", "A"}},
+		{key: "docker.insecure-registries[+]", want: []string{"docker", "insecure-registries", "[+]"}},
+		{key: "docker.features.buildkit", want: []string{"docker", "features", "buildkit"}},
+		{key: "mounts[0].location", want: []string{"mounts", "0", "location"}},
+		{key: "mounts.0.location", want: []string{"mounts", "0", "location"}},
+		{key: "kubernetes.k3sArgs[+]", want: []string{"kubernetes", "k3sArgs", "[+]"}},
+		{key: "mounts[+].location", wantErr: true},
+		{key: "unknown", wantErr: true},
+		{key: "cpu.count", wantErr: true},
+		{key: "cpu[0]", wantErr: true},
+		{key: "mounts[x]", wantErr: true},
+		{key: "network..dns", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := ParseKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCombinations(t *testing.T) {
+	valid := config.Config{VMType: "vz", MountType: "virtiofs", Runtime: "docker", Disk: 100, RootDisk: 20}
+	tests := []struct {
+		name string
+		edit func(c *config.Config)
+		keys []string
+	}{
+		{name: "valid", edit: func(c *config.Config) {}},
+		{name: "virtiofs with qemu", edit: func(c *config.Config) { c.VMType = "qemu" }, keys: []string{"mountType"}},
+		{name: "9p with vz", edit: func(c *config.Config) { c.MountType = "9p" }, keys: []string{"mountType"}},
+		{name: "root disk", edit: func(c *config.Config) { c.RootDisk = 100 }, keys: []string{"rootDisk"}},
+		{name: "rosetta", edit: func(c *config.Config) { c.VMType, c.MountType, c.VZRosetta = "qemu", "sshfs", true }, keys: []string{"rosetta"}},
+		{name: "preferred route", edit: func(c *config.Config) { c.Network.PreferredRoute = true }, keys: []string{"network.preferredRoute"}},
+		{name: "kubernetes with incus", edit: func(c *config.Config) { c.Runtime, c.Kubernetes.Enabled = "incus", true }, keys: []string{"kubernetes.enabled"}},
+		{name: "multiple", edit: func(c *config.Config) { c.RootDisk, c.Network.PreferredRoute = 200, true }, keys: []string{"rootDisk", "network.preferredRoute"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.edit(&c)
+			var keys []string
+			for _, e := range validateCombinations(c) {
+				keys = append(keys, e.Key)
+				if e.Hint == "" {
+					t.Errorf("missing hint for %s", e.Key)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("expected problems with %v, got %v", tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestHostValidate(t *testing.T) {
+	dir := t.TempDir()
+	host := Host{CPUs: 4, Memory: 8, DiskSize: 60, MacOS: true}
+	valid := config.Config{CPU: 2, Memory: 4, Disk: 100, Mounts: []config.Mount{{Location: dir}}}
+
+	tests := []struct {
+		name string
+		edit func(c *config.Config)
+		keys []string
+	}{
+		{name: "valid", edit: func(c *config.Config) {}},
+		{name: "cpu", edit: func(c *config.Config) { c.CPU = 8 }, keys: []string{"cpu"}},
+		{name: "memory", edit: func(c *config.Config) { c.Memory = 16 }, keys: []string{"memory"}},
+		{name: "disk shrink", edit: func(c *config.Config) { c.Disk = 50 }, keys: []string{"disk"}},
+		{name: "autostop", edit: func(c *config.Config) { c.AutoStop.IdleMinutes = 30 }},
+		{name: "missing mount", edit: func(c *config.Config) {
+			c.Mounts = append(c.Mounts, config.Mount{Location: filepath.Join(dir, "missing")})
+		}, keys: []string{"mounts.1.location"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.edit(&c)
+			var keys []string
+			for _, e := range host.validate(c) {
+				keys = append(keys, e.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("expected problems with %v, got %v", tt.keys, keys)
+			}
+		})
+	}
+
+	t.Run("autostop without macos", func(t *testing.T) {
+		host := host
+		host.MacOS = false
+		c := valid
+		c.AutoStop.IdleMinutes = 30
+		var keys []string
+		for _, e := range host.validate(c) {
+			keys = append(keys, e.Key)
+		}
+		if want := []string{"autoStop.idleMinutes"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("expected problems with %v, got %v", want, keys)
+		}
+	})
+}
+
+func TestValidationErrorsHint(t *testing.T) {
+	errs := ValidationErrors{
+		{Key: "cpu", Line: 3, Column: 6, Err: os.ErrInvalid, Hint: "set cpu to at most 4"},
+		{Key: "memory", Err: os.ErrInvalid},
+	}
+	want := "2 problems found:\n" +
+		"  - line 3, column 6: cpu: invalid argument\n" +
+		"    hint: set cpu to at most 4\n" +
+		"  - memory: invalid argument"
+	if got := errs.Error(); got != want {
+		t.Errorf("unexpected error\n%s\nwant\n%s", got, want)
+	}
+	if got := errs[:1].Error(); got != "line 3, column 6: cpu: invalid argument\nhint: set cpu to at most 4" {
+		t.Errorf("unexpected error %q", got)
+	}
+}
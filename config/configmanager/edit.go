@@ -0,0 +1,199 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/util/yamlutil"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseKey parses the dotted config key into the path of the config file.
+// List items are referenced by index e.g. mounts[0].location or mounts.0.location,
+// and [+] appends to a list e.g. docker.insecure-registries[+].
+// The keys of maps with scalar values may contain dots e.g. network.dnsHosts.host.docker.internal.
+func ParseKey(key string) ([]string, error) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := strings.Split(key, ".")
+	var path []string
+
+	// s is nil for values of any type, e.g. docker config
+	s := schema
+	for i := 0; i < len(segments); i++ {
+		name, indexes, err := splitIndexes(segments[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key '%s': %w", key, err)
+		}
+
+		if name != "" {
+			switch {
+			case s == nil:
+			case !slices.Contains(s.Type, "object"):
+				return nil, fmt.Errorf("invalid key '%s': '%s' is not an object", key, strings.Join(segments[:i], "."))
+			case s.Properties != nil:
+				if s = s.Properties[name]; s == nil {
+					return nil, fmt.Errorf("unknown config key: '%s'", strings.Join(segments[:i+1], "."))
+				}
+			default:
+				additional, _ := s.AdditionalProperties.(*Schema)
+				if additional != nil && !slices.Contains(additional.Type, "object") && !slices.Contains(additional.Type, "array") {
+					// the remaining key is the map key, as scalar values have no nested keys
+					rest := strings.Join(segments[i:], ".")
+					if strings.ContainsAny(rest, "[]") {
+						return nil, fmt.Errorf("invalid key '%s': '%s' is not a list", key, strings.Join(segments[:i], "."))
+					}
+					return append(path, rest), nil
+				}
+				s = additional
+			}
+			path = append(path, name)
+		}
+
+		for _, index := range indexes {
+			if s != nil {
+				if !slices.Contains(s.Type, "array") {
+					return nil, fmt.Errorf("invalid key '%s': '%s' is not a list", key, strings.Join(path, "."))
+				}
+				s = s.Items
+			}
+			path = append(path, index)
+		}
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid key '%s'", key)
+	}
+	if slices.Index(path, yamlutil.AppendIndex) >= 0 && path[len(path)-1] != yamlutil.AppendIndex {
+		return nil, fmt.Errorf("invalid key '%s': [+] must be at the end of the key", key)
+	}
+	return path, nil
+}
+
+// splitIndexes splits a key segment into the name and list indexes e.g. mounts[0] or 0.
+func splitIndexes(segment string) (name string, indexes []string, err error) {
+	if _, err := strconv.Atoi(segment); err == nil {
+		return "", []string{segment}, nil
+	}
+
+	name, rest, _ := strings.Cut(segment, "[")
+	if rest == "" {
+		if name == "" {
+			return "", nil, fmt.Errorf("empty key")
+		}
+		return name, nil, nil
+	}
+	for _, index := range strings.Split("["+rest, "[")[1:] {
+		index, ok := strings.CutSuffix(index, "]")
+		if !ok {
+			return "", nil, fmt.Errorf("unterminated index in '%s'", segment)
+		}
+		if index == "+" {
+			indexes = append(indexes, yamlutil.AppendIndex)
+			continue
+		}
+		if i, err := strconv.Atoi(index); err != nil || i < 0 {
+			return "", nil, fmt.Errorf("invalid index '%s' in '%s'", index, segment)
+		}
+		indexes = append(indexes, index)
+	}
+	return name, indexes, nil
+}
+
+// GetValue returns the node of the value of the key in the config file.
+func GetValue(file, key string) (*yaml.Node, error) {
+	path, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(path, yamlutil.AppendIndex) {
+		return nil, fmt.Errorf("invalid key '%s': [+] can only be used to set a value", key)
+	}
+	doc, err := yamlutil.ReadNode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := yamlutil.LookupNode(doc.Content[0], path)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not set in '%s'", key, file)
+	}
+	return node, nil
+}
+
+// SetValue sets the value of the key in the config file, comments and ordering are preserved.
+// The value is parsed as yaml e.g. 4, true, [a, b].
+// The file is not modified if the config would be invalid.
+func SetValue(file, key, value string) error {
+	path, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+
+	var v yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		return fmt.Errorf("invalid value '%s': %w", value, err)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	if len(v.Content) > 0 {
+		node = v.Content[0]
+	}
+
+	doc, err := yamlutil.ReadNode(file)
+	if err != nil {
+		return err
+	}
+	if err := yamlutil.SetNode(doc.Content[0], path, node); err != nil {
+		return err
+	}
+	return writeValidated(doc, file)
+}
+
+// UnsetValue removes the key from the config file, comments and ordering are preserved.
+// Lower config layers apply to keys that are not set.
+func UnsetValue(file, key string) error {
+	path, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(path, yamlutil.AppendIndex) {
+		return fmt.Errorf("invalid key '%s': [+] can only be used to set a value", key)
+	}
+
+	doc, err := yamlutil.ReadNode(file)
+	if err != nil {
+		return err
+	}
+	if !yamlutil.UnsetNode(doc.Content[0], path) {
+		return fmt.Errorf("'%s' is not set in '%s'", key, file)
+	}
+	return writeValidated(doc, file)
+}
+
+// writeValidated writes the config document to file if it is valid against the config schema.
+// Documents of older versions are migrated before the validation, see validateSchema.
+func writeValidated(doc *yaml.Node, file string) error {
+	schema, err := ConfigSchema()
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	errs := validateSchema(root, schema)
+	locateErrors(errs, root)
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	// the config file may not exist yet
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating config directory: %w", err)
+	}
+	return yamlutil.WriteNode(doc, file)
+}
@@ -0,0 +1,202 @@
+package configmanager
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/yamlutil"
+	"gopkg.in/yaml.v3"
+)
+
+// saveExtended saves the config to a file that extends another config.
+// Only the values that differ from the inherited values are saved, the other values
+// remain inherited from the extended config. Keys already in the file are updated in place
+// and comments are preserved.
+func saveExtended(c config.Config, file string) error {
+	values, err := configValues(c)
+	if err != nil {
+		return err
+	}
+
+	defaults, err := DefaultLayer()
+	if err != nil {
+		return err
+	}
+	parents, err := loadExtends(Layer{Name: LayerProfile, File: file, values: map[string]any{"extends": c.Extends}}, nil)
+	if err != nil {
+		return err
+	}
+	// the inherited values are decoded as config for the same defaults of omitted fields e.g. mounts[].writable
+	var inheritedConfig config.Config
+	if err := decodeValues(append(Layers{defaults}, parents...).rawValues(), &inheritedConfig); err != nil {
+		return err
+	}
+	inherited, err := configValues(inheritedConfig)
+	if err != nil {
+		return err
+	}
+
+	doc, err := yamlutil.ReadNode(file)
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+
+	// maps without keys are omitted from the values, the inherited keys are still removed
+	for _, m := range freeformMaps {
+		if key, _, _ := strings.Cut(m, "."); values[key] == nil {
+			values[key] = map[string]any{}
+		}
+	}
+
+	appendLists := c.ListMerge == config.ListMergeAppend
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		// the version and the extended config are not inherited
+		if key == "version" || key == "extends" {
+			if err := setChanged(root, []string{key}, values[key], nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setOverride(root, []string{key}, values[key], inherited[key], appendLists); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating config directory: %w", err)
+	}
+	return yamlutil.WriteNode(doc, file)
+}
+
+// setOverride sets the value at the path if it differs from the inherited value.
+// Maps are compared by their keys and appended lists by their additional items.
+// Keys removed from maps with arbitrary keys are removed, see removeMissing.
+func setOverride(root *yaml.Node, path []string, value, inherited any, appendLists bool) error {
+	m, _ := value.(map[string]any)
+	parent, _ := inherited.(map[string]any)
+	freeform := freeformKey(append(slices.Clone(path), ""))
+	if freeform {
+		if err := removeMissing(root, path, m, parent); err != nil {
+			return err
+		}
+	}
+	if len(m) > 0 || freeform {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if err := setOverride(root, append(slices.Clone(path), k), m[k], parent[k], appendLists); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if list, ok := value.([]any); ok && appendLists {
+		if parent, ok := inherited.([]any); ok {
+			value = slices.DeleteFunc(slices.Clone(list), func(item any) bool {
+				return slices.ContainsFunc(parent, func(v any) bool { return reflect.DeepEqual(v, item) })
+			})
+			inherited = nil
+		}
+	}
+
+	return setChanged(root, path, value, inherited)
+}
+
+// removeMissing removes the keys of the map with arbitrary keys at the path that are not in the value.
+// The keys in the file are removed, the inherited keys are overridden with a null value.
+func removeMissing(root *yaml.Node, path []string, value, inherited map[string]any) error {
+	keys := slices.Collect(maps.Keys(inherited))
+	if node, ok := yamlutil.LookupNode(root, path); ok && node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			keys = append(keys, node.Content[i].Value)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range slices.Compact(keys) {
+		if _, ok := value[k]; ok {
+			continue
+		}
+		keyPath := append(slices.Clone(path), k)
+		if _, ok := inherited[k]; !ok {
+			yamlutil.UnsetNode(root, keyPath)
+			continue
+		}
+		if err := setChanged(root, keyPath, nil, inherited[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setChanged sets the value at the path if it differs from the value in the file,
+// or from the inherited value if the path is not in the file.
+func setChanged(root *yaml.Node, path []string, value, inherited any) error {
+	if node, ok := yamlutil.LookupNode(root, path); ok {
+		var current any
+		if err := node.Decode(&current); err == nil && equalValues(current, value) {
+			return nil
+		}
+	} else if equalValues(inherited, value) {
+		return nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("error encoding config value: %w", err)
+	}
+	return yamlutil.SetNode(root, path, &node)
+}
+
+// equalValues returns if the values are equal, empty values are equivalent to missing values.
+func equalValues(a, b any) bool {
+	return reflect.DeepEqual(a, b) || (emptyValue(a) && emptyValue(b))
+}
+
+func emptyValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Map, reflect.Slice:
+		return r.Len() == 0
+	}
+	return r.IsZero()
+}
+
+// rawValues returns the merged values of the layers as in the files, without expanded variables.
+func (l Layers) rawValues() map[string]any {
+	values := map[string]any{}
+	for _, layer := range l {
+		mergeValues(values, layer.raw, layer.appendLists())
+	}
+	return values
+}
+
+// configValues returns the values of the config by their keys.
+func configValues(c config.Config) (map[string]any, error) {
+	var values map[string]any
+	if err := decodeValues(c, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// decodeValues decodes the values into v via yaml.
+func decodeValues(values any, v any) error {
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("error decoding config: %w", err)
+	}
+	return nil
+}
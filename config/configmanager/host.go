@@ -0,0 +1,79 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util"
+)
+
+// Host is the state of the host and of the existing instance, for host-aware validation.
+type Host struct {
+	// CPUs and Memory (in GiB) are the capacity of the host, 0 if unknown.
+	CPUs   int
+	Memory float32
+	// MacOS is if the host runs macOS, features such as autoStop are only available on macOS.
+	MacOS bool
+
+	// DiskSize is the size in GiB of the runtime disk of the existing instance, 0 if there is none.
+	DiskSize int
+	// Running is if the existing instance is running, its ports are then in use by itself.
+	Running bool
+}
+
+// CurrentHost returns the capacity of the host.
+// The state of the existing instance is left to the caller.
+func CurrentHost() Host {
+	h := Host{CPUs: runtime.NumCPU(), MacOS: util.MacOS()}
+	if memory, err := util.HostMemory(); err == nil {
+		h.Memory = float32(memory) / (1024 * 1024 * 1024)
+	}
+	return h
+}
+
+// validate validates the config against the host.
+func (h Host) validate(c config.Config) ValidationErrors {
+	var errs ValidationErrors
+
+	if h.CPUs > 0 && c.CPU > h.CPUs {
+		errs.addHint("cpu", fmt.Errorf("%d CPUs exceed the %d CPUs of the host", c.CPU, h.CPUs),
+			fmt.Sprintf("set cpu to at most %d", h.CPUs))
+	}
+	if h.Memory > 0 && c.Memory > h.Memory {
+		errs.addHint("memory", fmt.Errorf("%vGiB memory exceeds the %.1fGiB memory of the host", c.Memory, h.Memory),
+			fmt.Sprintf("set memory to less than %d", int(h.Memory)))
+	}
+
+	if h.DiskSize > 0 && c.Disk > 0 && c.Disk < h.DiskSize {
+		errs.addHint("disk", fmt.Errorf("disk cannot be reduced from %dGiB to %dGiB", h.DiskSize, c.Disk),
+			fmt.Sprintf("set disk to at least %d, or delete the instance with 'colima delete' to recreate it", h.DiskSize))
+	}
+
+	if c.AutoStop.Enabled() && !h.MacOS {
+		errs.addHint("autoStop.idleMinutes", fmt.Errorf("autoStop is only supported on macOS"),
+			"set autoStop.idleMinutes to 0")
+	}
+
+	if c.SSHPort > 0 && !h.Running {
+		if _, ok := util.FindAvailablePort(c.SSHPort, 1); !ok {
+			errs.addHint("sshPort", fmt.Errorf("port %d is already in use", c.SSHPort),
+				"set sshPort to an available port, or 0 for a random port")
+		}
+	}
+
+	for i, m := range c.Mounts {
+		location, err := util.CleanPath(m.Location)
+		if err != nil || location == "" {
+			continue
+		}
+		if _, err := os.Stat(location); os.IsNotExist(err) {
+			errs.addHint("mounts."+strconv.Itoa(i)+".location", fmt.Errorf("mount location '%s' does not exist", m.Location),
+				"create the directory or remove the mount")
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,205 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util"
+)
+
+// interpolatedPaths are the paths of the values with expanded variables.
+// "*" matches any key or list index, "**" matches all nested values.
+var interpolatedPaths = [][]string{
+	{"env", "*"},
+	{"docker", "**"},
+	{"mounts", "*", "location"},
+	{"mounts", "*", "mountPoint"},
+	{"provision", "*", "script"},
+	{"kubernetes", "k3sArgs", "*"},
+}
+
+// variables are ${VAR}, ${env:VAR}, ${VAR:-default} and ${file:path}, $${ escapes a variable.
+var variablePattern = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// scriptVariablePattern matches the variables expanded in provision scripts,
+// only ${env:VAR} and ${file:path}. Other variables are of the shell in the VM.
+var scriptVariablePattern = regexp.MustCompile(`\$?\$\{(?:env|file):[^}]*\}`)
+
+// interpolate expands the variables in the values of the interpolated paths.
+// dir is the directory of the config file, for relative file paths.
+// The values are modified in place, the expanded values are returned.
+func interpolate(values map[string]any, dir string) ([]config.Interpolated, error) {
+	var interpolated []config.Interpolated
+
+	for _, pattern := range interpolatedPaths {
+		expand := func(s string) (string, error) { return expandVariables(s, dir, true) }
+		if pattern[0] == "provision" {
+			expand = func(s string) (string, error) { return expandScriptVariables(s, dir) }
+		}
+
+		err := walkStrings(values, pattern, nil, func(path []string, raw string) (string, error) {
+			value, err := expand(raw)
+			if err != nil {
+				return raw, fmt.Errorf("error in %s: %w", strings.Join(path, "."), err)
+			}
+			if value != raw {
+				interpolated = append(interpolated, config.Interpolated{Path: path, Raw: raw, Value: value})
+			}
+			return value, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return interpolated, nil
+}
+
+// walkStrings calls fn for the string values matching the pattern and replaces them with the result.
+func walkStrings(v any, pattern []string, path []string, fn func(path []string, s string) (string, error)) error {
+	replace := func(key string, child any, set func(any)) error {
+		childPath := append(append([]string{}, path...), key)
+		if s, ok := child.(string); ok {
+			if len(pattern) > 1 && pattern[1] != "**" {
+				return nil
+			}
+			value, err := fn(childPath, s)
+			if err != nil {
+				return err
+			}
+			set(value)
+			return nil
+		}
+		rest := pattern[1:]
+		if pattern[0] == "**" {
+			rest = pattern
+		}
+		if len(rest) == 0 {
+			return nil
+		}
+		return walkStrings(child, rest, childPath, fn)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if pattern[0] != "*" && pattern[0] != "**" && pattern[0] != key {
+				continue
+			}
+			if err := replace(key, child, func(s any) { v[key] = s }); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if pattern[0] != "*" && pattern[0] != "**" {
+			return nil
+		}
+		for i, child := range v {
+			if err := replace(strconv.Itoa(i), child, func(s any) { v[i] = s }); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandVariables expands the variables in s.
+// Undefined variables without a default are an error if strict, otherwise left as is.
+func expandVariables(s string, dir string, strict bool) (string, error) {
+	var expandErr error
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		expr := match[2 : len(match)-1]
+
+		if file, ok := strings.CutPrefix(expr, "file:"); ok {
+			b, err := os.ReadFile(expandPath(file, dir))
+			if err != nil {
+				expandErr = fmt.Errorf("error reading file for '%s': %w", match, err)
+				return match
+			}
+			return strings.TrimRight(string(b), "\r\n")
+		}
+
+		name, def, hasDefault := strings.Cut(strings.TrimPrefix(expr, "env:"), ":-")
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		if hasDefault {
+			return def
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			return ""
+		}
+		if strict {
+			expandErr = fmt.Errorf("undefined variable '%s'", name)
+		}
+		return match
+	})
+	if expandErr != nil {
+		return s, expandErr
+	}
+	return expanded, nil
+}
+
+// expandScriptVariables expands the ${env:VAR} and ${file:path} variables in the provision script s,
+// other variables are left as is for the shell in the VM.
+func expandScriptVariables(s string, dir string) (string, error) {
+	var expandErr error
+	expanded := scriptVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		value, err := expandVariables(match, dir, true)
+		if err != nil {
+			expandErr = err
+		}
+		return value
+	})
+	if expandErr != nil {
+		return s, expandErr
+	}
+	return expanded, nil
+}
+
+// expandPath expands the home directory, relative paths are relative to dir.
+func expandPath(path, dir string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(util.HomeDir(), path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path
+}
+
+// restoreInterpolated restores the original form of the values with expanded variables
+// that have not been changed since.
+func restoreInterpolated(values map[string]any, interpolated []config.Interpolated) {
+	for _, i := range interpolated {
+		var v any = values
+		for n, key := range i.Path {
+			last := n == len(i.Path)-1
+			switch node := v.(type) {
+			case map[string]any:
+				if last && node[key] == i.Value {
+					node[key] = i.Raw
+				}
+				v = node[key]
+			case []any:
+				index, err := strconv.Atoi(key)
+				if err != nil || index >= len(node) {
+					v = nil
+					continue
+				}
+				if last && node[index] == i.Value {
+					node[index] = i.Raw
+				}
+				v = node[index]
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Config layers, from the lowest to the highest precedence.
+const (
+	LayerDefault  = "default"
+	LayerTemplate = "template"
+	LayerExtends  = "extends"
+	LayerProfile  = "profile"
+	LayerProject  = "project"
+	LayerFlag     = "flag"
+)
+
+// ProjectFileName is the name of the project-local config file.
+const ProjectFileName = ".colima.yaml"
+
+// projectDisallowedKeys are the keys that cannot be set by project-local config files,
+// as they would run commands on the host or in the VM by merely starting from a directory.
+var projectDisallowedKeys = []string{"hooks", "provision"}
+
+// Layer is a config file layer.
+type Layer struct {
+	Name string
+	File string
+
+	// values are with expanded variables, raw are as in the file.
+	values       map[string]any
+	raw          map[string]any
+	interpolated []config.Interpolated
+	// project is set for the project layer and the configs it extends. They are found
+	// in the current directory and not trusted to run commands or read host values.
+	project bool
+}
+
+// LayerValue is the value of a key in a layer.
+type LayerValue struct {
+	Layer Layer
+	Value any
+}
+
+// Layers are config file layers ordered by precedence, lowest first.
+type Layers []Layer
+
+// ProjectConfigError is an error loading a project config or the configs it extends.
+type ProjectConfigError struct {
+	File string
+	Err  error
+}
+
+func (p ProjectConfigError) Error() string {
+	return fmt.Sprintf("invalid project config '%s': %v", p.File, p.Err)
+}
+
+func (p ProjectConfigError) Unwrap() error { return p.Err }
+
+// LoadLayers loads the files of the layers.
+// Layers without a file or with a missing file are skipped.
+// The configs extended by a layer are loaded as extends layers below it, see ExtendsFile.
+// Errors of the project layer are returned as ProjectConfigError.
+func LoadLayers(layers ...Layer) (Layers, error) {
+	var loaded Layers
+	for _, layer := range layers {
+		wrap := func(err error) error {
+			if layer.Name == LayerProject {
+				return ProjectConfigError{File: layer.File, Err: err}
+			}
+			return err
+		}
+
+		layer, ok, err := loadLayer(layer)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		if !ok {
+			continue
+		}
+
+		parents, err := loadExtends(layer, nil)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		loaded = append(loaded, parents...)
+		loaded = append(loaded, layer)
+	}
+	return loaded, nil
+}
+
+// loadLayer loads the file of the layer and returns if the file exists.
+func loadLayer(layer Layer) (Layer, bool, error) {
+	if layer.File == "" {
+		return layer, false, nil
+	}
+	layer.project = layer.project || layer.Name == LayerProject
+	b, err := os.ReadFile(layer.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return layer, false, nil
+		}
+		return layer, false, fmt.Errorf("could not load %s config: %w", layer.Name, err)
+	}
+	if err := yaml.Unmarshal(b, &layer.values); err != nil {
+		return layer, false, fmt.Errorf("could not load %s config from file '%s': %w", layer.Name, layer.File, err)
+	}
+	if layer.values == nil {
+		layer.values = map[string]any{}
+	}
+	changes, err := Migrate(layer.values)
+	if err != nil {
+		return layer, false, fmt.Errorf("could not load %s config from file '%s': %w", layer.Name, layer.File, err)
+	}
+	warnMigrated(layer.File, changes)
+	_ = yaml.Unmarshal(b, &layer.raw)
+	if layer.raw == nil {
+		layer.raw = map[string]any{}
+	}
+	_, _ = Migrate(layer.raw)
+	// variables would expose the environment and files of the host to the VM
+	if !layer.project {
+		if layer.interpolated, err = interpolate(layer.values, filepath.Dir(layer.File)); err != nil {
+			return layer, false, fmt.Errorf("could not load %s config from file '%s': %w", layer.Name, layer.File, err)
+		}
+	}
+
+	if layer.Name == LayerProject {
+		for _, key := range projectDisallowedKeys {
+			if _, ok := layer.values[key]; ok {
+				return layer, false, fmt.Errorf("'%s' cannot be set in project config '%s'", key, layer.File)
+			}
+		}
+	}
+	return layer, true, nil
+}
+
+// loadExtends loads the chain of configs extended by the layer, lowest first.
+// chain is the files of the layers extending the layer.
+func loadExtends(layer Layer, chain []string) (Layers, error) {
+	name, _ := layer.values["extends"].(string)
+	if name == "" {
+		return nil, nil
+	}
+	chain = append(chain, layer.File)
+
+	file, err := ExtendsFile(name, filepath.Dir(layer.File))
+	if err != nil {
+		return nil, fmt.Errorf("invalid extends in %s config '%s': %w", layer.Name, layer.File, err)
+	}
+	if slices.Contains(chain, file) {
+		return nil, fmt.Errorf("invalid extends in %s config '%s': circular extends of '%s'", layer.Name, layer.File, name)
+	}
+
+	parent, ok, err := loadLayer(Layer{Name: LayerExtends, File: file, project: layer.project})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid extends in %s config '%s': '%s' not found", layer.Name, layer.File, file)
+	}
+	// the disallowed keys of project config cannot be inherited either
+	if layer.project {
+		for _, key := range projectDisallowedKeys {
+			if _, ok := parent.values[key]; ok {
+				return nil, fmt.Errorf("'%s' cannot be set in config '%s' extended by project config '%s'", key, file, layer.File)
+			}
+		}
+	}
+
+	parents, err := loadExtends(parent, chain)
+	if err != nil {
+		return nil, err
+	}
+	return append(parents, parent), nil
+}
+
+// ExtendsFile returns the config file of the name in the extends key of a config in dir.
+// The name is a profile, a template in the templates directory, or a file relative to dir
+// if it is a path e.g. ./base.yaml. Profiles take precedence over templates.
+func ExtendsFile(name, dir string) (string, error) {
+	if strings.ContainsRune(name, '/') || filepath.Ext(name) == ".yaml" || filepath.Ext(name) == ".yml" {
+		file := name
+		if file == "~" || strings.HasPrefix(file, "~/") {
+			file = filepath.Join(util.HomeDir(), file[1:])
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		return file, nil
+	}
+
+	if file := config.ProfileFile(name); fileExists(file) {
+		return file, nil
+	}
+	if file := filepath.Join(config.TemplatesDir(), name+".yaml"); fileExists(file) {
+		return file, nil
+	}
+	return "", fmt.Errorf("'%s' is not a profile or a template", name)
+}
+
+func fileExists(file string) bool {
+	stat, err := os.Stat(file)
+	return err == nil && !stat.IsDir()
+}
+
+// DefaultLayer returns the layer of the default config.
+func DefaultLayer() (Layer, error) {
+	layer := Layer{Name: LayerDefault}
+	b, err := embedded.Read("defaults/colima.yaml")
+	if err != nil {
+		return layer, fmt.Errorf("error reading default config: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &layer.values); err != nil {
+		return layer, fmt.Errorf("default config is invalid yaml: %w", err)
+	}
+	layer.raw = layer.values
+	return layer, nil
+}
+
+// Without returns the layers excluding the named layer.
+func (l Layers) Without(name string) Layers {
+	var layers Layers
+	for _, layer := range l {
+		if layer.Name != name {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// Get returns the named layer.
+func (l Layers) Get(name string) (Layer, bool) {
+	for _, layer := range l {
+		if layer.Name == name {
+			return layer, true
+		}
+	}
+	return Layer{}, false
+}
+
+// Config returns the config of the merged layers.
+// Maps are merged, other values are replaced by higher layers.
+// Lists are replaced, or appended to if the higher layer sets listMerge to append.
+// Null values do not override lower layers, except in the maps of arbitrary keys
+// where a null value removes the key set by lower layers, see freeformMaps.
+func (l Layers) Config() (config.Config, error) {
+	var c config.Config
+
+	values := map[string]any{}
+	for _, layer := range l {
+		mergeValues(values, layer.values, layer.appendLists())
+		c.Interpolated = append(c.Interpolated, layer.interpolated...)
+	}
+
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return c, fmt.Errorf("error merging config layers: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("error merging config layers: %w", err)
+	}
+	return c, nil
+}
+
+// Lookup returns the values of the dotted key in the layers that set it, lowest first.
+// The values are as in the files, without expanded variables.
+func (l Layers) Lookup(key string) []LayerValue {
+	var values []LayerValue
+	for _, layer := range l {
+		if v, ok := lookupValue(layer.raw, key); ok {
+			values = append(values, LayerValue{Layer: layer, Value: v})
+		}
+	}
+	return values
+}
+
+func lookupValue(values map[string]any, key string) (any, bool) {
+	var v any = values
+	for _, k := range strings.Split(key, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+// appendLists returns if the lists of the layer are appended to the lists of lower layers.
+func (l Layer) appendLists() bool {
+	return l.values["listMerge"] == config.ListMergeAppend
+}
+
+// freeformMaps are the keys of the maps with arbitrary keys, e.g. environment variables.
+// Their keys are removed by a higher layer with a null value,
+// as the keys cannot otherwise be removed once set by a lower layer.
+var freeformMaps = []string{"env", "docker", "network.dnsHosts"}
+
+// freeformKey returns if the key is within a map with arbitrary keys.
+func freeformKey(path []string) bool {
+	for _, m := range freeformMaps {
+		prefix := strings.Split(m, ".")
+		if len(path) > len(prefix) && slices.Equal(path[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeValues(dst, src map[string]any, appendLists bool) {
+	mergeValuesAt(nil, dst, src, appendLists)
+}
+
+func mergeValuesAt(path []string, dst, src map[string]any, appendLists bool) {
+	for k, v := range src {
+		if v == nil {
+			if freeformKey(append(slices.Clone(path), k)) {
+				delete(dst, k)
+			}
+			continue
+		}
+		if list, ok := v.([]any); ok && appendLists {
+			if dstList, ok := dst[k].([]any); ok {
+				dst[k] = appendUnique(dstList, list)
+				continue
+			}
+		}
+		srcMap, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstMap, ok := dst[k].(map[string]any)
+		if !ok {
+			dstMap = map[string]any{}
+			dst[k] = dstMap
+		}
+		mergeValuesAt(append(slices.Clone(path), k), dstMap, srcMap, appendLists)
+	}
+}
+
+// appendUnique returns the list with the items appended, excluding the items already in the list.
+func appendUnique(list, items []any) []any {
+	list = slices.Clone(list)
+	for _, item := range items {
+		if !slices.ContainsFunc(list, func(v any) bool { return reflect.DeepEqual(v, item) }) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// FindProjectFile returns the project-local config file in the directory or its
+// closest parent directory, or an empty string if there is none.
+func FindProjectFile(dir string) string {
+	for {
+		file := filepath.Join(dir, ProjectFileName)
+		if stat, err := os.Stat(file); err == nil && !stat.IsDir() {
+			return file
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,245 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Migration upgrades the config values of the previous version to Version.
+type Migration struct {
+	Version     int
+	Description string
+	// Migrate modifies the values in place and returns a description of each change.
+	Migrate func(values map[string]any) []string
+}
+
+// migrations are the config format migrations, ordered by version.
+// A migration must be added whenever the meaning of an existing key changes.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "replace legacy keys with their current equivalents",
+		Migrate:     migrateLegacyKeys,
+	},
+}
+
+// CurrentVersion is the current version of the config format.
+var CurrentVersion = migrations[len(migrations)-1].Version
+
+// Migrate upgrades the config values to the current version.
+// The values are modified in place and the changes made are returned,
+// excluding the update of the version.
+func Migrate(values map[string]any) ([]string, error) {
+	version, err := configVersion(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, m := range migrations {
+		if m.Version > version {
+			changes = append(changes, m.Migrate(values)...)
+		}
+	}
+	if version < CurrentVersion {
+		values["version"] = CurrentVersion
+	}
+	return changes, nil
+}
+
+// configVersion returns the version of the config values, 0 for config files created before versioning.
+func configVersion(values map[string]any) (int, error) {
+	v, ok := values["version"]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	version, ok := v.(int)
+	if !ok || version < 0 {
+		return 0, fmt.Errorf("invalid config version: '%v'", v)
+	}
+	if version > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is not supported by this version of colima, upgrade colima to the latest version", version)
+	}
+	return version, nil
+}
+
+// MigrateFile upgrades the config file to the current version and returns the changes.
+// The file is only updated if write is true.
+func MigrateFile(file string, write bool) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not load config from file: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("could not load config from file: %w", err)
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	version, err := configVersion(values)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := Migrate(values)
+	if err != nil {
+		return nil, err
+	}
+	if version < CurrentVersion {
+		changes = append([]string{fmt.Sprintf("version: %d updated to %d", version, CurrentVersion)}, changes...)
+	}
+
+	if !write || len(changes) == 0 {
+		return changes, nil
+	}
+
+	c, err := loadFrom(file, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveToFile(c, file); err != nil {
+		return nil, fmt.Errorf("error saving migrated config: %w", err)
+	}
+	return changes, nil
+}
+
+// MigrateLegacyValues sets the values of keys of the unversioned config in c, migrated
+// to the current version e.g. the values of the legacy flags of the start command.
+// The values are keyed by their dotted keys. The dotted keys set in c are returned.
+func MigrateLegacyValues(c *config.Config, legacy map[string]any) ([]string, error) {
+	if len(legacy) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]any{}
+	for key, value := range legacy {
+		parts := strings.Split(key, ".")
+		m := values
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := m[p].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				m[p] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = value
+	}
+	// the disabled components are added to the current k3s args
+	if k, ok := values["kubernetes"].(map[string]any); ok && k["disable"] != nil {
+		k["k3sArgs"] = c.Kubernetes.K3sArgs
+	}
+
+	// normalize the values as decoded from a config file
+	var migrated map[string]any
+	if err := decodeValues(values, &migrated); err != nil {
+		return nil, err
+	}
+	if _, err := Migrate(migrated); err != nil {
+		return nil, err
+	}
+	delete(migrated, "version")
+	if err := decodeValues(migrated, c); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if child, ok := v.(map[string]any); ok {
+				walk(prefix+k+".", child)
+				continue
+			}
+			keys = append(keys, prefix+k)
+		}
+	}
+	walk("", migrated)
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// k3sDisableArgs returns the k3s args to disable the components.
+func k3sDisableArgs(components []string) []string {
+	var args []string
+	for _, c := range components {
+		args = append(args, "--disable="+c)
+	}
+	return args
+}
+
+// migrateLegacyKeys migrates the keys of config files created before the config was versioned.
+func migrateLegacyKeys(values map[string]any) []string {
+	var changes []string
+
+	// activate was renamed to autoActivate
+	if v, ok := values["activate"]; ok {
+		delete(values, "activate")
+		if _, ok := values["autoActivate"]; !ok {
+			values["autoActivate"] = v
+			changes = append(changes, fmt.Sprintf("activate: %v replaced with autoActivate: %v", v, v))
+		} else {
+			changes = append(changes, "activate removed, autoActivate is set")
+		}
+	}
+
+	k, ok := values["kubernetes"].(map[string]any)
+	if !ok {
+		return changes
+	}
+
+	var k3sArgs []any
+	_, hasK3sArgs := k["k3sArgs"]
+	if list, ok := k["k3sArgs"].([]any); ok {
+		k3sArgs = list
+	}
+	addArgs := func(args []string) {
+		for _, arg := range args {
+			if !slices.Contains(k3sArgs, any(arg)) {
+				k3sArgs = append(k3sArgs, arg)
+			}
+		}
+	}
+
+	// ingress was replaced with k3s args, traefik is disabled by default
+	if ingress, ok := k["ingress"]; ok {
+		delete(k, "ingress")
+		if ingress == true {
+			changes = append(changes, "kubernetes.ingress: true replaced with kubernetes.k3sArgs without --disable=traefik")
+		} else {
+			addArgs(k3sDisableArgs([]string{"traefik"}))
+			changes = append(changes, "kubernetes.ingress: false replaced with kubernetes.k3sArgs: --disable=traefik")
+		}
+		// the default k3s args would otherwise apply
+		hasK3sArgs = true
+	}
+
+	// disable was replaced with k3s args
+	if disable, ok := k["disable"].([]any); ok {
+		delete(k, "disable")
+		var components []string
+		for _, d := range disable {
+			components = append(components, fmt.Sprint(d))
+		}
+		args := k3sDisableArgs(components)
+		addArgs(args)
+		hasK3sArgs = true
+		changes = append(changes, fmt.Sprintf("kubernetes.disable: %v replaced with kubernetes.k3sArgs: %v", components, args))
+	}
+
+	if hasK3sArgs {
+		if k3sArgs == nil {
+			k3sArgs = []any{}
+		}
+		k["k3sArgs"] = k3sArgs
+	}
+
+	return changes
+}
@@ -0,0 +1,167 @@
+package configmanager
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/util/yamlutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 []string           `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// schemaEnums are the allowed values of config keys.
+// Empty values are always allowed and replaced with the defaults.
+var schemaEnums = map[string][]string{
+	"listMerge":           {config.ListMergeReplace, config.ListMergeAppend},
+	"runtime":             {"docker", "containerd", "incus", "none"},
+	"modelRunner":         {"docker", "ramalama"},
+	"vmType":              {"qemu", "vz", "krunkit"},
+	"mountType":           {"9p", "sshfs", "virtiofs"},
+	"disks.fsType":        {"ext4", "xfs", "btrfs"},
+	"portForwarder":       {"ssh", "grpc", "none"},
+	"network.mode":        {"shared", "bridged"},
+	"provision.mode":      {"system", "user", config.ProvisionModeAfterBoot, config.ProvisionModeReady},
+	"provision.onFailure": {config.ProvisionOnFailureWarn, config.ProvisionOnFailureAbort},
+}
+
+// ConfigSchema returns the JSON Schema of the config.
+// Descriptions are taken from the comments of the default config.
+func ConfigSchema() (*Schema, error) {
+	descriptions, err := templateDescriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	s := schemaFor("", reflect.TypeFor[config.Config](), descriptions)
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = "Colima configuration"
+	return s, nil
+}
+
+var ipType = reflect.TypeFor[net.IP]()
+
+// schemaFor returns the schema for the type at the key.
+// Keys of list items are the same as the key of the list.
+func schemaFor(key string, typ reflect.Type, descriptions map[string]string) *Schema {
+	s := &Schema{Description: descriptions[key]}
+
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	// every value can be omitted with null, except objects with properties
+	nullable := func(t string) []string { return []string{t, "null"} }
+
+	switch {
+	case typ == ipType:
+		s.Type = nullable("string")
+	case typ.Kind() == reflect.Struct:
+		s.Type = []string{"object"}
+		s.AdditionalProperties = false
+		s.Properties = map[string]*Schema{}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			if key != "" {
+				name = key + "." + name
+			}
+			s.Properties[propertyName(name)] = schemaFor(name, field.Type, descriptions)
+		}
+	case typ.Kind() == reflect.Map:
+		s.Type = nullable("object")
+		if typ.Elem().Kind() != reflect.Interface {
+			s.AdditionalProperties = schemaFor("", typ.Elem(), nil)
+		}
+	case typ.Kind() == reflect.Slice:
+		s.Type = nullable("array")
+		s.Items = schemaFor(key, typ.Elem(), nil)
+	case typ.Kind() == reflect.String:
+		s.Type = nullable("string")
+		if values, ok := schemaEnums[key]; ok {
+			s.Enum = []any{"", nil}
+			for _, v := range values {
+				s.Enum = append(s.Enum, v)
+			}
+		}
+	case typ.Kind() == reflect.Bool:
+		s.Type = nullable("boolean")
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		s.Type = nullable("integer")
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		s.Type = nullable("number")
+	}
+
+	return s
+}
+
+func propertyName(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// templateDescriptions returns the descriptions of the keys from the comments of the default config.
+func templateDescriptions() (map[string]string, error) {
+	b, err := embedded.Read("defaults/colima.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading default config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("default config is invalid yaml: %w", err)
+	}
+
+	descriptions := map[string]string{}
+	if len(doc.Content) == 0 {
+		return descriptions, nil
+	}
+	// list items are examples, not keys
+	yamlutil.WalkNode("", doc.Content[0], func(key string, _, keyNode, _ *yaml.Node) bool {
+		if keyNode == nil {
+			return false
+		}
+		descriptions[key] = commentParagraph(keyNode.HeadComment)
+		return true
+	})
+	return descriptions, nil
+}
+
+// commentParagraph returns the last paragraph of a yaml comment block
+// without the comment markers, up to the default value or example.
+func commentParagraph(comment string) string {
+	// the last blank line separates the comment of the key from preceding comments
+	blocks := strings.Split(comment, "\n\n")
+	comment = blocks[len(blocks)-1]
+
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+		if line == "" || slices.ContainsFunc([]string{"Default:", "EXAMPLE", "NOTE:", "Colima default"}, func(p string) bool {
+			return strings.HasPrefix(line, p)
+		}) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
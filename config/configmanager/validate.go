@@ -0,0 +1,265 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/yamlutil"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem with a config key.
+type ValidationError struct {
+	// Key is the dotted key of the config value, list items are keyed by their index.
+	Key string
+	// Line and Column are the position of the value in the config file, 0 if unknown.
+	Line   int
+	Column int
+	Err    error
+	// Hint is the remediation of the problem, if any.
+	Hint string
+}
+
+func (v ValidationError) Error() string {
+	if v.Hint != "" {
+		return v.problem() + "\nhint: " + v.Hint
+	}
+	return v.problem()
+}
+
+func (v ValidationError) problem() string {
+	if v.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s: %v", v.Line, v.Column, v.Key, v.Err)
+	}
+	return fmt.Sprintf("%s: %v", v.Key, v.Err)
+}
+
+func (v ValidationError) Unwrap() error { return v.Err }
+
+// ValidationErrors are all the problems of a config.
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	if len(v) == 1 {
+		return v[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems found:", len(v))
+	for _, e := range v {
+		b.WriteString("\n  - " + e.problem())
+		if e.Hint != "" {
+			b.WriteString("\n    hint: " + e.Hint)
+		}
+	}
+	return b.String()
+}
+
+func (v *ValidationErrors) add(key string, err error) {
+	*v = append(*v, ValidationError{Key: key, Err: err})
+}
+
+// addHint adds the problem with a remediation hint.
+func (v *ValidationErrors) addHint(key string, err error, hint string) {
+	*v = append(*v, ValidationError{Key: key, Err: err, Hint: hint})
+}
+
+// err returns nil if there are no errors.
+func (v ValidationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// ValidateConfigFile validates the config loaded from file, with overrides (if any) applied.
+// The file is validated against the config schema and all problems are
+// reported with their line and column in the file.
+// Host-aware rules are only checked if host is not nil.
+func ValidateConfigFile(c config.Config, file string, host *Host) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not load config from file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("could not load config from file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return ValidateConfig(c, host)
+	}
+	root := doc.Content[0]
+
+	schema, err := ConfigSchema()
+	if err != nil {
+		return err
+	}
+
+	errs := validateSchema(root, schema)
+
+	// the values are only meaningful if the types are valid
+	if len(errs) == 0 {
+		if err := ValidateConfig(c, host); err != nil {
+			errs = err.(ValidationErrors)
+		}
+	}
+
+	locateErrors(errs, root)
+	return errs.err()
+}
+
+// validateSchema validates the yaml document of a config file against the schema.
+// Keys of older versions would fail the schema, the migrated values are validated instead.
+func validateSchema(root *yaml.Node, schema *Schema) ValidationErrors {
+	var errs ValidationErrors
+
+	var values map[string]any
+	if err := root.Decode(&values); err != nil || values == nil {
+		values = map[string]any{}
+	}
+	if version, err := configVersion(values); err != nil {
+		errs.add("version", err)
+	} else if version == CurrentVersion {
+		validateNode("", root, schema, &errs)
+	} else if migrated, err := migratedNode(values); err != nil {
+		errs.add("version", err)
+	} else {
+		validateNode("", migrated, schema, &errs)
+	}
+
+	return errs
+}
+
+// locateErrors sets the position of the errors without one to that of the
+// closest key present in the yaml document e.g. problems of migrated values.
+func locateErrors(errs ValidationErrors, root *yaml.Node) {
+	nodes := yamlutil.NodeValues(root)
+	for i, e := range errs {
+		if e.Line > 0 {
+			continue
+		}
+		for key := e.Key; key != ""; key = parentKey(key) {
+			if node, ok := nodes[key]; ok {
+				errs[i].Line, errs[i].Column = node.Line, node.Column
+				break
+			}
+		}
+	}
+}
+
+// migratedNode returns the yaml node of the values migrated to the current version.
+// The node has no position in the file.
+func migratedNode(values map[string]any) (*yaml.Node, error) {
+	if _, err := Migrate(values); err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := node.Encode(values); err != nil {
+		return nil, fmt.Errorf("error encoding migrated config: %w", err)
+	}
+	return &node, nil
+}
+
+// schemaKey returns the key without the list indexes.
+func schemaKey(key string) string {
+	var parts []string
+	for _, p := range strings.Split(key, ".") {
+		if _, err := strconv.Atoi(p); err != nil {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func parentKey(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// validateNode validates the yaml node against the schema.
+func validateNode(key string, node *yaml.Node, s *Schema, errs *ValidationErrors) {
+	fail := func(n *yaml.Node, key string, format string, a ...any) {
+		*errs = append(*errs, ValidationError{Key: key, Line: n.Line, Column: n.Column, Err: fmt.Errorf(format, a...)})
+	}
+
+	// the schemas of the valid collections, for their children
+	schemas := map[*yaml.Node]*Schema{}
+	validate := func(key string, node *yaml.Node, s *Schema) bool {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		nodeType := yamlNodeType(node)
+		if nodeType == "null" {
+			if !slices.Contains(s.Type, "null") {
+				fail(node, key, "value cannot be null")
+			}
+			return false
+		}
+		// scalars are decoded into strings as is
+		if node.Kind == yaml.ScalarNode && slices.Contains(s.Type, "string") {
+			nodeType = "string"
+		}
+		if !slices.Contains(s.Type, nodeType) && !(nodeType == "integer" && slices.Contains(s.Type, "number")) {
+			fail(node, key, "expected %s, got %s", s.Type[0], nodeType)
+			return false
+		}
+
+		if node.Kind == yaml.ScalarNode {
+			if len(s.Enum) > 0 && !slices.Contains(s.Enum, any(node.Value)) {
+				fail(node, key, "invalid value '%s', must be one of %s", node.Value, strings.Join(schemaEnums[schemaKey(key)], ", "))
+			}
+			return false
+		}
+		schemas[node] = s
+		return true
+	}
+
+	if !validate(key, node, s) {
+		return
+	}
+	yamlutil.WalkNode(key, node, func(key string, parent, keyNode, value *yaml.Node) bool {
+		s := schemas[parent]
+		if keyNode == nil {
+			return s.Items != nil && validate(key, value, s.Items)
+		}
+		if prop, ok := s.Properties[keyNode.Value]; ok {
+			return validate(key, value, prop)
+		}
+		switch additional := s.AdditionalProperties.(type) {
+		case *Schema:
+			return validate(key, value, additional)
+		case bool:
+			if !additional {
+				fail(keyNode, key, "unknown key")
+			}
+		}
+		return false
+	})
+}
+
+// yamlNodeType returns the JSON Schema type of the yaml node.
+func yamlNodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return "null"
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	}
+	return "string"
+}
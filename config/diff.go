@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeClass is the action required to apply a config change to a running instance.
+// The classes are ordered by impact.
+type ChangeClass int
+
+const (
+	// ChangeLive is applied to the running VM without restarting it.
+	ChangeLive ChangeClass = iota
+	// ChangeRuntimeRestart requires restarting the container runtimes.
+	ChangeRuntimeRestart
+	// ChangeVMRestart requires restarting the VM.
+	ChangeVMRestart
+	// ChangeRecreate requires deleting and recreating the VM.
+	ChangeRecreate
+)
+
+func (c ChangeClass) String() string {
+	switch c {
+	case ChangeLive:
+		return "live"
+	case ChangeRuntimeRestart:
+		return "runtime restart"
+	case ChangeVMRestart:
+		return "vm restart"
+	case ChangeRecreate:
+		return "recreate"
+	}
+	return fmt.Sprintf("ChangeClass(%d)", int(c))
+}
+
+// changeClasses maps config keys to the class of their changes.
+// The longest matching key applies, unlisted keys require a VM restart.
+var changeClasses = map[string]ChangeClass{
+	"arch":      ChangeRecreate,
+	"vmType":    ChangeRecreate,
+	"runtime":   ChangeRecreate,
+	"mountType": ChangeRecreate,
+	"diskImage": ChangeRecreate,
+	"rootDisk":  ChangeRecreate,
+
+	"network.dnsHosts": ChangeLive,
+	"autoActivate":     ChangeLive,
+	"sshConfig":        ChangeLive,
+	"modelRunner":      ChangeLive,
+	"diskImageMirror":  ChangeLive,
+	"forceDiskImage":   ChangeLive,
+	"provision":        ChangeLive, // scripts run on startup
+	"hooks":            ChangeLive,
+	"drain":            ChangeLive,
+
+	"docker":     ChangeRuntimeRestart, // applied by restarting dockerd
+	"kubernetes": ChangeRuntimeRestart,
+
+	"env": ChangeVMRestart, // read by the VM and the runtimes on boot
+}
+
+// Change is a changed config key.
+type Change struct {
+	Key   string
+	Old   any
+	New   any
+	Class ChangeClass
+}
+
+// Changes are the changes between two configs.
+type Changes []Change
+
+// Class returns the highest class of the changes.
+func (c Changes) Class() ChangeClass {
+	class := ChangeLive
+	for _, change := range c {
+		class = max(class, change.Class)
+	}
+	return class
+}
+
+// Has returns if the key or any of its sub keys is changed.
+func (c Changes) Has(key string) bool {
+	for _, change := range c {
+		if change.Key == key || strings.HasPrefix(change.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the changes from old to new config, sorted by key.
+// Nested keys are separated by dots, lists are compared as a whole.
+func Diff(old, new Config) (Changes, error) {
+	oldKeys, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+	newKeys, err := flatten(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes Changes
+	add := func(key string, o, n any) {
+		// the config version and inheritance are not settings, the effective values are compared
+		if key == "version" || key == "extends" || key == "listMerge" {
+			return
+		}
+		// omitted keys are equivalent to their empty values
+		if reflect.DeepEqual(o, n) || (empty(o) && empty(n)) {
+			return
+		}
+		changes = append(changes, Change{Key: key, Old: o, New: n, Class: changeClass(key, o, n)})
+	}
+	for key, o := range oldKeys {
+		add(key, o, newKeys[key])
+	}
+	for key, n := range newKeys {
+		if _, ok := oldKeys[key]; !ok {
+			add(key, nil, n)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+func changeClass(key string, old, new any) ChangeClass {
+	// the disk can only be increased
+	if key == "disk" {
+		o, _ := old.(int)
+		n, _ := new.(int)
+		if n < o {
+			return ChangeRecreate
+		}
+		return ChangeVMRestart
+	}
+
+	class, match := ChangeVMRestart, ""
+	for k, c := range changeClasses {
+		if (key == k || strings.HasPrefix(key, k+".")) && len(k) > len(match) {
+			class, match = c, k
+		}
+	}
+	return class
+}
+
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Map, reflect.Slice:
+		return r.Len() == 0
+	}
+	return r.IsZero()
+}
+
+// flatten returns the values of the config by their dotted key.
+func flatten(c Config) (map[string]any, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling config: %w", err)
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config: %w", err)
+	}
+
+	keys := map[string]any{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			for k, v := range m {
+				walk(prefix+"."+k, v)
+			}
+			return
+		}
+		keys[prefix] = v
+	}
+	for k, v := range m {
+		walk(k, v)
+	}
+	return keys, nil
+}
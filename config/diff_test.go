@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	base := Config{
+		CPU:     2,
+		Disk:    100,
+		Memory:  2,
+		Arch:    "aarch64",
+		Runtime: "docker",
+		Network: Network{DNSHosts: map[string]string{"host.docker.internal": "host.lima.internal"}},
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(c *Config)
+		keys   []string
+		class  ChangeClass
+		change int // index of the change to check the class of
+	}{
+		{name: "none", edit: func(c *Config) {}, class: ChangeLive},
+		{name: "docker", edit: func(c *Config) { c.Docker = map[string]any{"debug": true} }, keys: []string{"docker.debug"}, class: ChangeRuntimeRestart},
+		{name: "env", edit: func(c *Config) { c.Env = map[string]string{"KEY": "value"} }, keys: []string{"env.KEY"}, class: ChangeVMRestart},
+		{name: "dns host", edit: func(c *Config) { c.Network.DNSHosts = map[string]string{"example.com": "1.2.3.4"} },
+			keys: []string{"network.dnsHosts.example.com", "network.dnsHosts.host.docker.internal"}, class: ChangeLive},
+		{name: "kubernetes", edit: func(c *Config) { c.Kubernetes.Enabled = true }, keys: []string{"kubernetes.enabled"}, class: ChangeRuntimeRestart},
+		{name: "cpu", edit: func(c *Config) { c.CPU = 4 }, keys: []string{"cpu"}, class: ChangeVMRestart},
+		{name: "network address", edit: func(c *Config) { c.Network.Address = true }, keys: []string{"network.address"}, class: ChangeVMRestart},
+		{name: "disk increase", edit: func(c *Config) { c.Disk = 200 }, keys: []string{"disk"}, class: ChangeVMRestart},
+		{name: "disk decrease", edit: func(c *Config) { c.Disk = 50 }, keys: []string{"disk"}, class: ChangeRecreate},
+		{name: "arch", edit: func(c *Config) { c.Arch = "x86_64" }, keys: []string{"arch"}, class: ChangeRecreate},
+		{name: "runtime", edit: func(c *Config) { c.Runtime = "containerd" }, keys: []string{"runtime"}, class: ChangeRecreate},
+		{name: "mixed", edit: func(c *Config) {
+			c.CPU = 4
+			c.SSHConfig = true
+		}, keys: []string{"cpu", "sshConfig"}, class: ChangeVMRestart, change: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			c.Network.DNSHosts = map[string]string{}
+			for k, v := range base.Network.DNSHosts {
+				c.Network.DNSHosts[k] = v
+			}
+			tt.edit(&c)
+
+			changes, err := Diff(base, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(tt.keys) {
+				t.Fatalf("expected %d changes, got %+v", len(tt.keys), changes)
+			}
+			for i, key := range tt.keys {
+				if changes[i].Key != key {
+					t.Errorf("expected change %d to be %s, got %s", i, key, changes[i].Key)
+				}
+			}
+			if got := changes.Class(); got != tt.class {
+				t.Errorf("expected class %v, got %v", tt.class, got)
+			}
+			if tt.change > 0 && changes[tt.change].Class != ChangeLive {
+				t.Errorf("expected change %s to be %v, got %v", changes[tt.change].Key, ChangeLive, changes[tt.change].Class)
+			}
+		})
+	}
+}
@@ -38,6 +38,12 @@ func ProfileFromName(name string) *Profile {
 	return &i
 }
 
+// ProfileFile returns the path to the config file of the named profile.
+// Unlike Profile.File, the config directory of the profile is not created.
+func ProfileFile(name string) string {
+	return filepath.Join(configBaseDir.Dir(), ProfileFromName(name).ShortName, configFileName)
+}
+
 // CurrentProfile returns the current running profile.
 func CurrentProfile() *Profile { return profile }
 
@@ -88,6 +94,17 @@ func (p *Profile) StoreFile() string {
 	return filepath.Join(storeDir.Dir(), p.ID+".json")
 }
 
+// LockFile returns the path to the lock file against concurrent lifecycle commands.
+func (p *Profile) LockFile() string {
+	return filepath.Join(storeDir.Dir(), p.ID+".lock")
+}
+
+// HistoryFile returns the path to the lifecycle history file.
+// Unlike the store, the history is retained when the profile is deleted.
+func (p *Profile) HistoryFile() string {
+	return filepath.Join(storeDir.Dir(), p.ID+".history.jsonl")
+}
+
 var _ ProfileInfo = (*Profile)(nil)
 
 // ProfileInfo is the information about a profile.
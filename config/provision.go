@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Provision modes managed by Colima (not passed to Lima).
+const (
+	ProvisionModeAfterBoot = "after-boot"
+	ProvisionModeReady     = "ready"
+)
+
+// Provision failure policies.
+const (
+	ProvisionOnFailureWarn  = "warn"
+	ProvisionOnFailureAbort = "abort"
+)
+
+type Provision struct {
+	Mode   string `yaml:"mode"`
+	Script string `yaml:"script"`
+
+	// the options below are only supported by the modes managed by Colima.
+
+	// Name identifies the script for dependencies and status.
+	Name string `yaml:"name,omitempty"`
+	// Once runs the script only once for the lifetime of the VM.
+	Once bool `yaml:"once,omitempty"`
+	// Timeout is the maximum duration of the script e.g. 30s, 5m.
+	Timeout string `yaml:"timeout,omitempty"`
+	// OnFailure is the failure policy, one of warn (default) or abort.
+	OnFailure string `yaml:"onFailure,omitempty"`
+	// DependsOn are the names of the scripts that must succeed before the script runs.
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+// IsColimaMode returns true if the provision script is managed by Colima
+// rather than being passed to Lima.
+func (p Provision) IsColimaMode() bool {
+	return p.Mode == ProvisionModeAfterBoot || p.Mode == ProvisionModeReady
+}
+
+// TimeoutDuration returns the timeout of the script.
+// A zero duration is returned if unset.
+func (p Provision) TimeoutDuration() (time.Duration, error) {
+	if p.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout '%s': %w", p.Timeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid timeout '%s': must be positive", p.Timeout)
+	}
+	return d, nil
+}
+
+// AbortOnFailure returns if startup should be aborted when the script fails.
+func (p Provision) AbortOnFailure() bool { return p.OnFailure == ProvisionOnFailureAbort }
+
+// ProvisionScripts returns the provision scripts for the Colima managed mode
+// ordered by their dependencies.
+// Scripts without dependencies retain the order in the config.
+func (c Config) ProvisionScripts(mode string) ([]Provision, error) {
+	names := map[string]Provision{}
+	var scripts []Provision
+	for i, s := range c.Provision {
+		if !s.IsColimaMode() {
+			continue
+		}
+		if s.Name == "" {
+			s.Name = s.Mode + "#" + strconv.Itoa(i+1)
+		}
+		names[s.Name] = s
+		if s.Mode == mode {
+			scripts = append(scripts, s)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var ordered []Provision
+
+	var visit func(s Provision) error
+	visit = func(s Provision) error {
+		switch state[s.Name] {
+		case visiting:
+			return fmt.Errorf("provision script '%s' has a circular dependency", s.Name)
+		case visited:
+			return nil
+		}
+		state[s.Name] = visiting
+
+		for _, dep := range s.DependsOn {
+			d, ok := names[dep]
+			if !ok {
+				return fmt.Errorf("provision script '%s' depends on unknown script '%s'", s.Name, dep)
+			}
+			// dependencies in an earlier mode would have already been run
+			if d.Mode != mode {
+				if d.Mode == ProvisionModeReady {
+					return fmt.Errorf("provision script '%s' cannot depend on '%s', %s scripts run after %s scripts",
+						s.Name, dep, ProvisionModeReady, ProvisionModeAfterBoot)
+				}
+				continue
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+
+		state[s.Name] = visited
+		ordered = append(ordered, s)
+		return nil
+	}
+
+	for _, s := range scripts {
+		if err := visit(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
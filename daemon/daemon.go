@@ -3,10 +3,12 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/daemon/process/autostop"
 	"github.com/abiosoft/colima/daemon/process/inotify"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/environment"
@@ -21,6 +23,8 @@ type Manager interface {
 	Stop(context.Context, config.Config) error
 	Running(context.Context, config.Config) (Status, error)
 	Dependency(ctx context.Context, conf config.Config, name string) (deps process.Dependency, root bool)
+	// Command returns the command line used to start the daemon for conf.
+	Command(conf config.Config) ([]string, error)
 }
 
 type Status struct {
@@ -97,6 +101,16 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 		return fmt.Errorf("error preparing daemon directory: %w", err)
 	}
 
+	args, err := l.Command(conf)
+	if err != nil {
+		return err
+	}
+
+	host := l.host.WithDir(util.HomeDir())
+	return host.RunQuiet(args...)
+}
+
+func (l processManager) Command(conf config.Config) ([]string, error) {
 	args := []string{osutil.Executable(), "daemon", "start", config.CurrentProfile().ShortName}
 
 	if conf.Network.Address {
@@ -110,19 +124,28 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 		for _, mount := range conf.MountsOrDefault() {
 			p, err := util.CleanPath(mount.Location)
 			if err != nil {
-				return fmt.Errorf("error sanitising mount path for inotify: %w", err)
+				return nil, fmt.Errorf("error sanitising mount path for inotify: %w", err)
 			}
 			args = append(args, "--inotify-dir", p)
 		}
 	}
 
+	if conf.AutoStop.Enabled() {
+		args = append(args, "--autostop")
+		args = append(args, "--autostop-idle", strconv.Itoa(conf.AutoStop.IdleMinutes))
+		args = append(args, "--autostop-runtime", conf.Runtime)
+		if conf.Kubernetes.Enabled {
+			args = append(args, "--autostop-kubernetes")
+		}
+	}
+
 	if cli.Settings.Verbose {
 		args = append(args, "--very-verbose")
 	}
 
-	host := l.host.WithDir(util.HomeDir())
-	return host.RunQuiet(args...)
+	return args, nil
 }
+
 func (l processManager) Stop(ctx context.Context, conf config.Config) error {
 	if s, err := l.Running(ctx, conf); err != nil || !s.Running {
 		return nil
@@ -139,6 +162,9 @@ func processesFromConfig(conf config.Config) []process.Process {
 	if conf.MountINotify {
 		processes = append(processes, inotify.New())
 	}
+	if conf.AutoStop.Enabled() {
+		processes = append(processes, autostop.New())
+	}
 
 	return processes
 }
@@ -0,0 +1,266 @@
+package autostop
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/incus"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/osutil"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "autostop"
+const checkInterval = time.Minute
+
+type Args struct {
+	environment.GuestActions
+	Runtime    string
+	Kubernetes bool
+	Idle       time.Duration
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "autostop_args"} }
+
+// New returns the auto-stop process.
+// The process stops the VM after it has been idle for the duration in the args.
+func New() process.Process {
+	return &autostopProcess{
+		log: logrus.WithField("context", "autostop"),
+	}
+}
+
+var _ process.Process = (*autostopProcess)(nil)
+
+type autostopProcess struct {
+	args Args
+	log  *logrus.Entry
+}
+
+// Alive implements process.Process
+func (a *autostopProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume autostop is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("autostop not running")
+}
+
+// Dependencies implements process.Process
+func (*autostopProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*autostopProcess) Name() string { return Name }
+
+// Start implements process.Process
+func (a *autostopProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+	if args.Idle <= 0 {
+		return fmt.Errorf("invalid idle duration: %v", args.Idle)
+	}
+	a.args = args
+	log := a.log
+
+	log.Infof("stopping VM after %v of inactivity", args.Idle)
+
+	timer := newIdleTimer(args.Idle, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(checkInterval):
+		}
+
+		busy, err := a.busy()
+		if err != nil {
+			// the state is unknown, err on the side of caution
+			log.Warnln(fmt.Errorf("error checking activity: %w", err))
+			busy = true
+		}
+
+		idle, expired := timer.observe(time.Now(), busy)
+		if busy {
+			continue
+		}
+		log.Tracef("idle for %v", idle.Round(time.Second))
+		if !expired {
+			continue
+		}
+
+		log.Infof("idle for %v, stopping VM", idle.Round(time.Second))
+		return a.stop()
+	}
+}
+
+// idleTimer tracks the period of inactivity.
+type idleTimer struct {
+	idle       time.Duration
+	lastActive time.Time
+}
+
+func newIdleTimer(idle time.Duration, now time.Time) *idleTimer {
+	return &idleTimer{idle: idle, lastActive: now}
+}
+
+// observe records the activity at now and returns the period of inactivity,
+// and if it has reached the idle duration. Activity resets the timer.
+func (t *idleTimer) observe(now time.Time, busy bool) (idle time.Duration, expired bool) {
+	if busy {
+		t.lastActive = now
+		return 0, false
+	}
+	idle = now.Sub(t.lastActive)
+	return idle, idle >= t.idle
+}
+
+// stop stops the profile.
+// The stop command terminates the daemon, it is thereby not waited for.
+func (a *autostopProcess) stop() error {
+	cmd := cli.Command(osutil.Executable(), "stop", config.CurrentProfile().ShortName)
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error stopping VM: %w", err)
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// busy returns if there are running containers or active ssh sessions in the VM.
+func (a *autostopProcess) busy() (bool, error) {
+	i, err := limautil.Instance()
+	if err != nil {
+		return false, fmt.Errorf("error retrieving instance: %w", err)
+	}
+	if !i.Running() {
+		return false, fmt.Errorf("VM not running")
+	}
+
+	checks := []func() (bool, error){a.sshSessions}
+	switch a.args.Runtime {
+	case docker.Name:
+		checks = append(checks, a.dockerContainers)
+	case containerd.Name:
+		checks = append(checks, a.containerdContainers)
+	case incus.Name:
+		checks = append(checks, a.incusInstances)
+	}
+	if a.args.Kubernetes {
+		checks = append(checks, a.kubernetesPods)
+	}
+
+	for _, check := range checks {
+		if busy, err := check(); err != nil || busy {
+			return busy, err
+		}
+	}
+	return false, nil
+}
+
+func (a *autostopProcess) sshSessions() (bool, error) {
+	out, err := a.args.RunOutput("who")
+	if err != nil {
+		return false, fmt.Errorf("error listing ssh sessions: %w", err)
+	}
+	return listed(out), nil
+}
+
+func (a *autostopProcess) dockerContainers() (bool, error) {
+	// kubernetes pods are also docker containers, the namespace distinguishes them
+	out, err := a.args.RunOutput("sudo", "docker", "ps", "--format", `ns={{.Label "io.kubernetes.pod.namespace"}}`)
+	if err != nil {
+		return false, fmt.Errorf("error listing docker containers: %w", err)
+	}
+	return dockerBusy(out), nil
+}
+
+func (a *autostopProcess) containerdContainers() (bool, error) {
+	out, err := a.args.RunOutput("sudo", "nerdctl", "namespace", "list", "-q")
+	if err != nil {
+		return false, fmt.Errorf("error retrieving containerd namespaces: %w", err)
+	}
+
+	for _, ns := range containerdNamespaces(out) {
+		out, err := a.args.RunOutput("sudo", "nerdctl", "--namespace", ns, "ps", "-q")
+		if err != nil {
+			return false, fmt.Errorf("error listing containerd containers: %w", err)
+		}
+		if listed(out) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *autostopProcess) incusInstances() (bool, error) {
+	out, err := a.args.RunOutput("sudo", "incus", "list", "status=running", "-c", "n", "--format", "csv")
+	if err != nil {
+		return false, fmt.Errorf("error listing incus instances: %w", err)
+	}
+	return listed(out), nil
+}
+
+func (a *autostopProcess) kubernetesPods() (bool, error) {
+	out, err := a.args.RunOutput("sudo", "k3s", "kubectl", "get", "pods", "--all-namespaces",
+		"--field-selector=status.phase=Running", "--no-headers", "-o", "custom-columns=NAMESPACE:.metadata.namespace")
+	if err != nil {
+		return false, fmt.Errorf("error listing kubernetes pods: %w", err)
+	}
+	return kubernetesBusy(out), nil
+}
+
+// listed returns if the output of a listing command has any entries.
+func listed(out string) bool {
+	return strings.TrimSpace(out) != ""
+}
+
+// dockerBusy returns if the output of docker ps, one pod namespace label per
+// container, has containers other than the kubernetes system pods.
+// Containers that are not kubernetes pods have an empty label i.e. "ns=".
+func dockerBusy(out string) bool {
+	for _, ns := range strings.Fields(out) {
+		if ns != "ns=kube-system" {
+			return true
+		}
+	}
+	return false
+}
+
+// containerdNamespaces returns the namespaces in the output of nerdctl namespace list
+// to check for containers. Kubernetes pods are checked separately.
+func containerdNamespaces(out string) []string {
+	var namespaces []string
+	for _, ns := range strings.Fields(out) {
+		if ns == "k8s.io" {
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+// kubernetesBusy returns if the output of kubectl get pods, one namespace per
+// running pod, has pods outside the system namespace which are always running.
+func kubernetesBusy(out string) bool {
+	for _, ns := range strings.Fields(out) {
+		if ns != "kube-system" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package autostop
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_dockerBusy(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want bool
+	}{
+		{name: "none", out: "", want: false},
+		{name: "blank", out: "\n", want: false},
+		{name: "container", out: "ns=", want: true},
+		{name: "system pods", out: "ns=kube-system\nns=kube-system", want: false},
+		{name: "system pods and container", out: "ns=kube-system\nns=", want: true},
+		{name: "pod", out: "ns=kube-system\nns=default", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dockerBusy(tt.out); got != tt.want {
+				t.Errorf("dockerBusy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_containerdNamespaces(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{name: "none", out: "", want: nil},
+		{name: "kubernetes", out: "k8s.io\n", want: nil},
+		{name: "default", out: "buildkit\ndefault\nk8s.io\n", want: []string{"buildkit", "default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerdNamespaces(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerdNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_kubernetesBusy(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want bool
+	}{
+		{name: "none", out: "", want: false},
+		{name: "system pods", out: "kube-system\nkube-system\n", want: false},
+		{name: "pod", out: "kube-system\ndefault\n", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kubernetesBusy(tt.out); got != tt.want {
+				t.Errorf("kubernetesBusy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_listed(t *testing.T) {
+	tests := []struct {
+		out  string
+		want bool
+	}{
+		{out: "", want: false},
+		{out: " \n", want: false},
+		{out: "3f2a1b\n", want: true},
+	}
+	for _, tt := range tests {
+		if got := listed(tt.out); got != tt.want {
+			t.Errorf("listed(%q) = %v, want %v", tt.out, got, tt.want)
+		}
+	}
+}
+
+func Test_idleTimer(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	type observation struct {
+		minute  int
+		busy    bool
+		idle    time.Duration
+		expired bool
+	}
+	tests := []struct {
+		name         string
+		observations []observation
+	}{
+		{
+			name: "idle",
+			observations: []observation{
+				{minute: 1, idle: time.Minute},
+				{minute: 4, idle: 4 * time.Minute},
+				{minute: 5, idle: 5 * time.Minute, expired: true},
+			},
+		},
+		{
+			name: "activity resets",
+			observations: []observation{
+				{minute: 4, idle: 4 * time.Minute},
+				{minute: 5, busy: true},
+				{minute: 9, idle: 4 * time.Minute},
+				{minute: 10, idle: 5 * time.Minute, expired: true},
+			},
+		},
+		{
+			name: "busy",
+			observations: []observation{
+				{minute: 5, busy: true},
+				{minute: 10, busy: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timer := newIdleTimer(5*time.Minute, start)
+			for _, o := range tt.observations {
+				idle, expired := timer.observe(at(o.minute), o.busy)
+				if idle != o.idle || expired != o.expired {
+					t.Errorf("minute %d: got idle %v expired %v, want idle %v expired %v",
+						o.minute, idle, expired, o.idle, o.expired)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.Drainer = (*containerdRuntime)(nil)
+
+// restart policy label set by nerdctl for the containerd restart monitor.
+const restartPolicyFormat = `{{index .Config.Labels "containerd.io/restart.policy"}}`
+
+// Drain implements environment.Drainer.
+// The containers in all namespaces are drained, the containers in the result
+// are prefixed with the namespace i.e. namespace/container.
+func (c containerdRuntime) Drain(ctx context.Context, timeout time.Duration) (r environment.DrainResult, err error) {
+	out, err := c.guest.RunOutput("sudo", "nerdctl", "namespace", "list", "-q")
+	if err != nil {
+		return r, fmt.Errorf("error retrieving containerd namespaces: %w", err)
+	}
+
+	var errs []string
+	for _, ns := range strings.Fields(out) {
+		nr, err := environment.DrainContainers(c.guest, timeout, restartPolicyFormat, "sudo", "nerdctl", "--namespace", ns)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("namespace %s: %v", ns, err))
+		}
+		for _, name := range nr.Restart {
+			r.Restart = append(r.Restart, ns+"/"+name)
+		}
+		for _, name := range nr.Killed {
+			r.Killed = append(r.Killed, ns+"/"+name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return r, fmt.Errorf("error draining containers: %s", strings.Join(errs, "; "))
+	}
+	return r, nil
+}
+
+// Restore implements environment.Drainer.
+func (c containerdRuntime) Restore(ctx context.Context, containers []string) error {
+	namespaces := map[string][]string{}
+	var order []string
+	for _, container := range containers {
+		ns, name, ok := strings.Cut(container, "/")
+		if !ok {
+			continue
+		}
+		if _, ok := namespaces[ns]; !ok {
+			order = append(order, ns)
+		}
+		namespaces[ns] = append(namespaces[ns], name)
+	}
+
+	for _, ns := range order {
+		args := append([]string{"sudo", "nerdctl", "--namespace", ns, "start"}, namespaces[ns]...)
+		if err := c.guest.RunQuiet(args...); err != nil {
+			return fmt.Errorf("error starting containers in namespace %s: %w", ns, err)
+		}
+	}
+	return nil
+}
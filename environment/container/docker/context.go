@@ -35,6 +35,11 @@ func (d dockerRuntime) useContext() error {
 	return d.host.Run("docker", "context", "use", config.CurrentProfile().ID)
 }
 
+func (d dockerRuntime) currentContext() string {
+	current, _ := d.host.RunOutput("docker", "context", "show")
+	return current
+}
+
 func (d dockerRuntime) teardownContext() error {
 	if !d.contextCreated() {
 		return nil
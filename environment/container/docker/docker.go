@@ -71,9 +71,16 @@ func (d dockerRuntime) Provision(ctx context.Context) error {
 	})
 
 	// docker context
-	a.Add(d.setupContext)
+	if !d.contextCreated() {
+		a.Add(d.setupContext)
+		a.Undo(d.teardownContext)
+	}
 	if conf.AutoActivate() {
+		previous := d.currentContext()
 		a.Add(d.useContext)
+		if previous != "" && previous != config.CurrentProfile().ID {
+			a.Undo(func() error { return d.host.RunQuiet("docker", "context", "use", previous) })
+		}
 	}
 
 	return a.Exec()
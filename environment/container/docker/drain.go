@@ -0,0 +1,23 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.Drainer = (*dockerRuntime)(nil)
+
+// Drain implements environment.Drainer.
+func (d dockerRuntime) Drain(ctx context.Context, timeout time.Duration) (environment.DrainResult, error) {
+	return environment.DrainContainers(d.guest, timeout, "{{.HostConfig.RestartPolicy.Name}}", "sudo", "docker")
+}
+
+// Restore implements environment.Drainer.
+func (d dockerRuntime) Restore(ctx context.Context, containers []string) error {
+	if len(containers) == 0 {
+		return nil
+	}
+	return d.guest.RunQuiet(append([]string{"sudo", "docker", "start"}, containers...)...)
+}
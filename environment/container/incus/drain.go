@@ -0,0 +1,95 @@
+package incus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.Drainer = (*incusRuntime)(nil)
+
+// Drain implements environment.Drainer.
+// The instances in all projects are drained, the instances in the result
+// are prefixed with the project i.e. project/instance.
+func (c *incusRuntime) Drain(ctx context.Context, timeout time.Duration) (r environment.DrainResult, err error) {
+	running, err := c.runningInstances()
+	if err != nil {
+		return r, err
+	}
+	if len(running) == 0 {
+		return r, nil
+	}
+
+	for project, names := range running {
+		for _, name := range names {
+			// instances are restarted on startup unless autostart is explicitly disabled
+			autostart, _ := c.guest.RunOutput("sudo", "incus", "config", "get", "--project", project, name, "boot.autostart")
+			if autostart != "false" {
+				r.Restart = append(r.Restart, project+"/"+name)
+			}
+		}
+
+		// the error is handled by checking the instances still running
+		args := append([]string{"sudo", "incus", "stop", "--project", project, "--timeout", strconv.Itoa(int(timeout.Seconds()))}, names...)
+		_ = c.guest.RunQuiet(args...)
+	}
+
+	running, err = c.runningInstances()
+	if err != nil {
+		return r, err
+	}
+	for project, names := range running {
+		args := append([]string{"sudo", "incus", "stop", "--project", project, "--force"}, names...)
+		if err := c.guest.RunQuiet(args...); err != nil {
+			return r, fmt.Errorf("error stopping instances: %w", err)
+		}
+		for _, name := range names {
+			r.Killed = append(r.Killed, project+"/"+name)
+		}
+	}
+
+	return r, nil
+}
+
+// runningInstances returns the running instances by project.
+func (c *incusRuntime) runningInstances() (map[string][]string, error) {
+	out, err := c.guest.RunOutput("sudo", "incus", "list", "--all-projects", "status=running", "-c", "en", "--format", "csv")
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances: %w", err)
+	}
+
+	instances := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		project, name, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if !ok {
+			continue
+		}
+		instances[project] = append(instances[project], name)
+	}
+	return instances, nil
+}
+
+// Restore implements environment.Drainer.
+func (c *incusRuntime) Restore(ctx context.Context, instances []string) error {
+	// instances with autostart enabled would have been started by incus
+	running, err := c.runningInstances()
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		project, name, ok := strings.Cut(instance, "/")
+		if !ok || slices.Contains(running[project], name) {
+			continue
+		}
+		if err := c.guest.RunQuiet("sudo", "incus", "start", "--project", project, name); err != nil {
+			return fmt.Errorf("error starting instance %s: %w", instance, err)
+		}
+	}
+	return nil
+}
@@ -25,11 +25,6 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 
 	a.Stage("updating config")
 
-	// remove existing configs (if any)
-	// this is safe as the profile name is unique to colima
-	c.unsetKubeconfig(a)
-
-	// ensure host kube directory exists
 	hostHome := c.host.Env("HOME")
 	if hostHome == "" {
 		return fmt.Errorf("error retrieving home directory on host")
@@ -37,15 +32,36 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 
 	profile := config.CurrentProfile().ID
 	hostKubeDir := filepath.Join(hostHome, ".kube")
-	a.Add(func() error {
-		return c.host.Run("mkdir", "-p", filepath.Join(hostKubeDir, "."+profile))
-	})
-
 	kubeconfFile := filepath.Join(hostKubeDir, "config")
 	envKubeConfFile := c.host.Env("KUBECONFIG")
 	if envKubeConfFile != "" {
 		kubeconfFile = filepath.SplitList(envKubeConfFile)[0]
 	}
+
+	// restore the kubeconfig if the startup fails afterwards
+	var prevKubeconfig *string
+	a.Add(func() error {
+		if kubeconfig, err := c.host.Read(kubeconfFile); err == nil {
+			prevKubeconfig = &kubeconfig
+		}
+		return nil
+	})
+	a.Undo(func() error {
+		if prevKubeconfig == nil {
+			return c.host.Run("rm", "-f", kubeconfFile)
+		}
+		return c.host.Write(kubeconfFile, []byte(*prevKubeconfig))
+	})
+
+	// remove existing configs (if any)
+	// this is safe as the profile name is unique to colima
+	c.unsetKubeconfig(a)
+
+	// ensure host kube directory exists
+	a.Add(func() error {
+		return c.host.Run("mkdir", "-p", filepath.Join(hostKubeDir, "."+profile))
+	})
+
 	tmpkubeconfFile := filepath.Join(hostKubeDir, "."+profile, "colima-temp")
 
 	// manipulate in VM and save to host
@@ -0,0 +1,107 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drainer is implemented by container runtimes that can gracefully stop
+// their running containers before the runtime is stopped.
+type Drainer interface {
+	// Drain stops the running containers, waiting up to timeout for each
+	// container to stop before it is killed.
+	Drain(ctx context.Context, timeout time.Duration) (DrainResult, error)
+	// Restore starts the containers in DrainResult.Restart of a previous drain.
+	Restore(ctx context.Context, containers []string) error
+}
+
+// DrainResult is the result of draining the containers of a runtime.
+type DrainResult struct {
+	// Restart are the containers that would have been restarted by their
+	// restart policy, and are to be started on next startup.
+	Restart []string
+	// Killed are the containers that did not stop within the timeout and were killed.
+	Killed []string
+}
+
+// exit code of a container killed with SIGKILL.
+const killedExitCode = 128 + 9
+
+// DrainContainers drains the running containers using a docker compatible cli.
+// policyFormat is the inspect format for the restart policy of a container.
+func DrainContainers(guest GuestActions, timeout time.Duration, policyFormat string, cli ...string) (r DrainResult, err error) {
+	command := func(args ...string) []string {
+		return append(slices.Clone(cli), args...)
+	}
+
+	out, err := guest.RunOutput(command("ps", "-q")...)
+	if err != nil {
+		return r, fmt.Errorf("error listing containers: %w", err)
+	}
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return r, nil
+	}
+
+	// restart policies must be retrieved before the containers are stopped
+	out, err = guest.RunOutput(command(append([]string{"inspect", "--format", "{{.Name}} " + policyFormat}, ids...)...)...)
+	if err != nil {
+		return r, fmt.Errorf("error retrieving restart policies: %w", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		name, policy, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch policy {
+		case "always", "unless-stopped":
+			r.Restart = append(r.Restart, strings.TrimPrefix(name, "/"))
+		}
+	}
+
+	// the time of the guest, the exit times of the containers are compared with it
+	out, err = guest.RunOutput("date", "-u", "+%Y-%m-%dT%H:%M:%S.%NZ")
+	if err != nil {
+		return r, fmt.Errorf("error retrieving time: %w", err)
+	}
+	stopped, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(out))
+	if err != nil {
+		return r, fmt.Errorf("error parsing time: %w", err)
+	}
+
+	seconds := strconv.Itoa(int(timeout.Seconds()))
+	if err := guest.RunQuiet(command(append([]string{"stop", "-t", seconds}, ids...)...)...); err != nil {
+		return r, fmt.Errorf("error stopping containers: %w", err)
+	}
+
+	out, err = guest.RunOutput(command(append([]string{"inspect", "--format", exitFormat}, ids...)...)...)
+	if err != nil {
+		return r, fmt.Errorf("error retrieving container exit codes: %w", err)
+	}
+	r.Killed = killedContainers(out, stopped.Add(timeout))
+
+	return r, nil
+}
+
+// exitFormat is the inspect format of the exit state of a container, parsed by killedContainers.
+const exitFormat = "{{.Name}} {{.State.ExitCode}} {{.State.OOMKilled}} {{.State.FinishedAt}}"
+
+// killedContainers returns the containers in the inspect output of exitFormat
+// that were killed by the drain i.e. still running at the deadline of the timeout.
+// Containers killed for running out of memory also exit with the killed exit code.
+func killedContainers(out string, deadline time.Time) []string {
+	var killed []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[1] != strconv.Itoa(killedExitCode) || fields[2] == "true" {
+			continue
+		}
+		finished, err := time.Parse(time.RFC3339Nano, fields[3])
+		if err != nil || finished.Before(deadline) {
+			continue
+		}
+		killed = append(killed, strings.TrimPrefix(fields[0], "/"))
+	}
+	return killed
+}
@@ -0,0 +1,32 @@
+package environment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_killedContainers(t *testing.T) {
+	deadline := time.Date(2026, 1, 2, 15, 4, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{name: "none", out: "", want: nil},
+		{name: "stopped", out: "/web 0 false 2026-01-02T15:04:06.5Z", want: nil},
+		{name: "killed", out: "/web 137 false 2026-01-02T15:04:30.000123456Z", want: []string{"web"}},
+		{name: "out of memory", out: "/web 137 true 2026-01-02T15:04:31Z", want: nil},
+		{name: "killed before the timeout", out: "/web 137 false 2026-01-02T15:04:10Z", want: nil},
+		{name: "multiple", out: "/web 137 false 2026-01-02T15:04:31Z\n/db 143 false 2026-01-02T15:04:05Z\n/cache 137 false 2026-01-02T15:04:32Z\n",
+			want: []string{"web", "cache"}},
+		{name: "invalid time", out: "/web 137 false never", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := killedContainers(tt.out, deadline); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("killedContainers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
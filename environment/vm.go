@@ -4,6 +4,7 @@ import (
 	"context"
 	"runtime"
 
+	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/util"
 )
 
@@ -13,6 +14,23 @@ type VM interface {
 	Dependencies
 	Host() HostActions
 	Teardown(ctx context.Context) error
+	// Plan returns the actions a start with conf would perform,
+	// without performing any of them.
+	Plan(ctx context.Context, conf config.Config) (VMPlan, error)
+}
+
+// VMPlan describes the actions of a VM startup.
+type VMPlan struct {
+	// Action is either create (new VM) or resume (existing VM).
+	Action string `yaml:"action"`
+	// Daemon is the command for the background daemon, empty if not required.
+	Daemon []string `yaml:"daemon"`
+	// RuntimeDisk is the decision for the runtime disk.
+	RuntimeDisk string `yaml:"runtimeDisk"`
+	// DataDisks are the decisions for the data disks.
+	DataDisks []string `yaml:"dataDisks,omitempty"`
+	// Config is the generated VM config.
+	Config any `yaml:"config"`
 }
 
 // VM configurations
@@ -13,16 +13,28 @@ import (
 	"github.com/abiosoft/colima/util"
 )
 
-func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.Context, error) {
-	// vmnet is used by QEMU, Krunkit, or bridged mode
-	useVmnet := conf.VMType == limaconfig.QEMU || conf.VMType == limaconfig.Krunkit || conf.Network.Mode == "bridged"
+// vmnetRequired returns if vmnet is used by the VM for conf.
+// vmnet is used by QEMU, Krunkit, or bridged mode.
+func vmnetRequired(conf config.Config) bool {
+	return conf.VMType == limaconfig.QEMU || conf.VMType == limaconfig.Krunkit || conf.Network.Mode == "bridged"
+}
 
+// daemonConfig returns the config the daemon is started with,
+// and if the daemon is required at all.
+func daemonConfig(conf config.Config) (config.Config, bool) {
 	// network daemon is only needed for vmnet
-	conf.Network.Address = conf.Network.Address && useVmnet
+	conf.Network.Address = conf.Network.Address && vmnetRequired(conf)
 
 	// limited to macOS (with vmnet required)
-	// or with inotify enabled
-	if !util.MacOS() || (!conf.MountINotify && !conf.Network.Address) {
+	// or with inotify or auto-stop enabled
+	return conf, util.MacOS() && (conf.MountINotify || conf.Network.Address || conf.AutoStop.Enabled())
+}
+
+func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.Context, error) {
+	useVmnet := vmnetRequired(conf)
+
+	conf, required := daemonConfig(conf)
+	if !required {
 		return ctx, nil
 	}
 
@@ -83,7 +95,7 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 
 	statusKey := struct{ key string }{key: "daemonStatus"}
 	// delay to ensure that the processes have started
-	if conf.Network.Address || conf.MountINotify {
+	if conf.Network.Address || conf.MountINotify || conf.AutoStop.Enabled() {
 		a.Retry("", time.Second*1, 15, func(i int) error {
 			s, err := l.daemon.Running(ctx, conf)
 			ctx = context.WithValue(ctx, statusKey, s)
@@ -103,7 +115,8 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 	}
 
 	// network failure is not fatal
-	if err := a.Exec(); err != nil {
+	err := a.Exec()
+	if err != nil {
 		if useVmnet {
 			func() {
 				installed, _ := ctx.Value(networkInstalledKey).(bool)
@@ -135,6 +148,10 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 		}
 	}
 
+	if err != nil && !useVmnet && conf.AutoStop.Enabled() {
+		log.Warnln(fmt.Errorf("error starting auto-stop: %w", err))
+	}
+
 	// check if inotify is running
 	if conf.MountINotify {
 		if inotifyEnabled, _ := ctx.Value(ctxKeyInotify).(bool); !inotifyEnabled {
@@ -0,0 +1,47 @@
+#!/usr/bin/env sh
+
+# Steps:
+# 1. Identify disk by its Lima name e.g. /dev/vdc
+# 2. Check if disk is already mounted, if yes, skip setup
+# 3. Format disk if it is empty, a disk with any data is never formatted
+# 4. Mount disk
+
+DISK_NAME="{{ .Name }}"
+MOUNT_POINT="{{ .MountPoint }}"
+LIMA_ENV="/mnt/lima-cidata/lima.env"
+
+# Lima lists the devices of the additional disks by index
+INDEX="$(sed -n "s/^LIMA_CIDATA_DISK_\([0-9]*\)_NAME=${DISK_NAME}\$/\1/p" "$LIMA_ENV")"
+DEVICE="$(sed -n "s/^LIMA_CIDATA_DISK_${INDEX}_DEVICE=//p" "$LIMA_ENV")"
+if [ -z "$INDEX" ] || [ -z "$DEVICE" ]; then
+	echo "Disk ${DISK_NAME} not found."
+	exit 1
+fi
+DISK="/dev/${DEVICE}"
+DISK_PART="${DISK}1"
+
+# Check current mount state before touching the disk.
+if findmnt --noheadings --source "$DISK_PART" --target "$MOUNT_POINT" >/dev/null 2>&1; then
+	echo "Disk already mounted, skipping setup."
+	exit 0
+fi
+
+# formatted once, a disk with a filesystem is never formatted
+if ! blkid "$DISK_PART" >/dev/null 2>&1; then
+	# the disk has data in another layout e.g. a partition table or a filesystem on the whole disk
+	if blkid "$DISK" >/dev/null 2>&1 || [ -e "$DISK_PART" ]; then
+		echo "Disk ${DISK_NAME} is not empty, refusing to format."
+		exit 1
+	fi
+{{- if .Format }}
+	echo 'type=83' | sfdisk "$DISK"
+	mkfs.{{ .FSType }} "$DISK_PART"
+{{- else }}
+	echo "Disk ${DISK_NAME} has no filesystem."
+	exit 1
+{{- end }}
+fi
+
+# mount disk
+mkdir -p "$MOUNT_POINT"
+mount "$DISK_PART" "$MOUNT_POINT"
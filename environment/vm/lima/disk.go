@@ -24,62 +24,193 @@ import (
 //go:embed disk.sh
 var diskScript string
 
-func (l *limaVM) createRuntimeDisk(conf config.Config) error {
+//go:embed data_disk.sh
+var dataDiskScript string
+
+// runtimeDisk is the decision for the runtime disk of an instance.
+type runtimeDisk struct {
+	Required bool   // runtime disk is in use
+	Name     string // the name of the lima disk, each runtime has its own disk
+	Create   bool   // disk does not exist and would be created
+	Format   bool   // disk would be formatted
+	FSType   string
+}
+
+// String returns a human-readable description of the decision.
+func (r runtimeDisk) String() string {
+	if !r.Required {
+		return "none"
+	}
+
+	action := "attach existing disk"
+	if r.Create {
+		action = "create new disk"
+	}
+	if r.Format {
+		action += ", format as " + r.FSType
+	}
+	return action
+}
+
+// newRuntimeDisk decides the runtime disk for a new instance.
+// hasDisk reports if the lima disk with the name exists.
+func newRuntimeDisk(conf config.Config, hasDisk func(name string) bool, s store.Store) (r runtimeDisk) {
 	if environment.IsNoneRuntime(conf.Runtime) {
 		// runtime disk is not required when no runtime is in use
-		return nil
+		return r
 	}
 
-	disk := dataDisk(conf.Runtime)
+	r.Required = true
+	r.Name = limautil.RuntimeDiskName(s, conf.Runtime)
+	r.FSType = DataDisk(conf.Runtime).FSType
+	r.Format = !s.RuntimeDisks[conf.Runtime].Formatted // only format if not previously formatted
 
-	s, _ := store.Load()
-	format := !s.DiskFormatted // only format if not previously formatted
+	if !hasDisk(r.Name) {
+		r.Create = true
+		r.Format = true // new disk should be formated
+	}
 
-	if !limautil.HasDisk() {
-		if err := limautil.CreateDisk(conf.Disk); err != nil {
-			return fmt.Errorf("error creating runtime disk: %w", err)
-		}
-		format = true // new disk should be formated
+	return r
+}
+
+// existingRuntimeDisk decides the runtime disk for a previously created instance.
+func existingRuntimeDisk(conf config.Config, hasDisk func(name string) bool, s store.Store) (r runtimeDisk) {
+	name := limautil.RuntimeDiskName(s, conf.Runtime)
+	if environment.IsNoneRuntime(conf.Runtime) || !hasDisk(name) {
+		return r
 	}
 
-	// when disk is formatted for the wrong runtime, prevent use
-	if s.DiskFormatted && s.DiskRuntime != "" && s.DiskRuntime != conf.Runtime {
-		return fmt.Errorf("runtime disk provisioned for %s runtime. Delete container data with 'colima delete --data' before using another runtime", s.DiskRuntime)
+	r.Required = true
+	r.Name = name
+	r.FSType = DataDisk(conf.Runtime).FSType
+	r.Format = !s.RuntimeDisks[conf.Runtime].Formatted // only format if not previously formatted
+	return r
+}
+
+// hasDisk returns if the lima disk with the name exists.
+func hasDisk(name string) bool {
+	_, ok := limautil.Disk(name)
+	return ok
+}
+
+func (l *limaVM) createRuntimeDisk(conf config.Config) error {
+	s, _ := store.Load()
+	disk := newRuntimeDisk(conf, hasDisk, s)
+	if !disk.Required {
+		return nil
 	}
 
-	l.limaConf.Disk = config.Disk(conf.RootDisk).GiB()
-	l.limaConf.AdditionalDisks = append(l.limaConf.AdditionalDisks, limaconfig.Disk{
-		Name:   config.CurrentProfile().ID,
-		Format: format,
-		FSType: disk.FSType,
-	})
+	if disk.Create {
+		if err := limautil.CreateNamedDisk(disk.Name, conf.Disk); err != nil {
+			return fmt.Errorf("error creating runtime disk: %w", err)
+		}
+	}
 
-	l.mountRuntimeDisk(conf, format)
+	l.attachRuntimeDisk(conf, disk)
 	return nil
 }
 
 func (l *limaVM) useRuntimeDisk(conf config.Config) {
-	if !limautil.HasDisk() {
+	s, _ := store.Load()
+	disk := existingRuntimeDisk(conf, hasDisk, s)
+	if !disk.Required {
 		l.limaConf.Disk = config.Disk(conf.Disk).GiB()
 		return
 	}
 
-	disk := dataDisk(conf.Runtime)
-
-	s, _ := store.Load()
-	format := !s.DiskFormatted // only format if not previously formatted
+	l.attachRuntimeDisk(conf, disk)
+}
 
+func (l *limaVM) attachRuntimeDisk(conf config.Config, disk runtimeDisk) {
 	l.limaConf.Disk = config.Disk(conf.RootDisk).GiB()
 	l.limaConf.AdditionalDisks = append(l.limaConf.AdditionalDisks, limaconfig.Disk{
-		Name:   config.CurrentProfile().ID,
-		Format: format,
+		Name:   disk.Name,
+		Format: disk.Format,
 		FSType: disk.FSType,
 	})
 
-	l.mountRuntimeDisk(conf, format)
+	l.mountRuntimeDisk(conf, disk.Format)
+}
+
+// createDataDisks creates the data disks that do not exist and grows the disks
+// that are smaller than their configured size.
+func (l *limaVM) createDataDisks(ctx context.Context, conf config.Config) error {
+	log := l.Logger(ctx)
+	for _, d := range conf.Disks {
+		name := limautil.DataDiskName(d.Name)
+		disk, ok := limautil.Disk(name)
+		if !ok {
+			log.Printf("creating disk '%s' ...", d.Name)
+			if err := limautil.CreateNamedDisk(name, d.Size); err != nil {
+				return fmt.Errorf("error creating disk '%s': %w", d.Name, err)
+			}
+			continue
+		}
+
+		if size := config.Disk(d.Size).Int(); disk.Size > size {
+			log.Warnf("disk '%s' cannot be reduced to %s, ignoring...", d.Name, config.Disk(d.Size).GiB())
+		} else if disk.Size < size {
+			log.Printf("resizing disk '%s' to %s...", d.Name, config.Disk(d.Size).GiB())
+			if err := limautil.ResizeNamedDisk(name, d.Size); err != nil {
+				log.Warnln(fmt.Errorf("unable to resize disk '%s': %w", d.Name, err))
+			}
+		}
+	}
+	return nil
+}
+
+// attachDataDisks attaches and mounts the data disks, after the runtime disk.
+// The disks are formatted by the mount script instead of Lima, only if they have no filesystem.
+func (l *limaVM) attachDataDisks(conf config.Config) {
+	for _, d := range conf.Disks {
+		name := limautil.DataDiskName(d.Name)
+		l.limaConf.AdditionalDisks = append(l.limaConf.AdditionalDisks, limaconfig.Disk{
+			Name:   name,
+			Format: false,
+		})
+		l.limaConf.Provision = append(l.limaConf.Provision, limaconfig.Provision{
+			Mode:   "dependency",
+			Script: dataDiskMountScript(d),
+		})
+	}
+}
+
+func dataDiskMountScript(d config.DataDisk) string {
+	var values = struct {
+		Name       string
+		MountPoint string
+		FSType     string
+		Format     bool
+	}{
+		Name:       limautil.DataDiskName(d.Name),
+		MountPoint: d.MountPointOrDefault(),
+		FSType:     d.FSTypeOrDefault(),
+		Format:     d.FormatOrDefault(),
+	}
+
+	b, err := util.ParseTemplate(dataDiskScript, values)
+	if err != nil {
+		// must never happen
+		panic(fmt.Sprintf("error parsing data disk mount script template: %v", err))
+	}
+	return string(b)
+}
+
+// dataDisksPlan returns the decisions for the data disks of an instance.
+func dataDisksPlan(conf config.Config) []string {
+	var plan []string
+	for _, d := range conf.Disks {
+		action := "attach existing disk"
+		if _, ok := limautil.Disk(limautil.DataDiskName(d.Name)); !ok {
+			action = fmt.Sprintf("create new disk (%s)", config.Disk(d.Size).GiB())
+		}
+		plan = append(plan, fmt.Sprintf("%s: %s, mount at %s", d.Name, action, d.MountPointOrDefault()))
+	}
+	return plan
 }
 
-func dataDisk(runtime string) environment.DataDisk {
+// DataDisk returns the data disk of the container runtime.
+func DataDisk(runtime string) environment.DataDisk {
 	switch runtime {
 	case docker.Name:
 		return docker.DataDisk()
@@ -117,7 +248,7 @@ func (l *limaVM) mountRuntimeDisk(conf config.Config, format bool) {
 	})
 
 	// handle disk mounts
-	disk := dataDisk(conf.Runtime)
+	disk := DataDisk(conf.Runtime)
 
 	// pre mount script
 	for _, script := range disk.PreMount {
@@ -222,7 +353,8 @@ func (l *limaVM) syncDiskSize(ctx context.Context, conf config.Config) config.Co
 			return false
 		}
 
-		if err := limautil.ResizeDisk(conf.Disk); err != nil {
+		s, _ := store.Load()
+		if err := limautil.ResizeNamedDisk(limautil.RuntimeDiskName(s, conf.Runtime), conf.Disk); err != nil {
 			log.Warnln(fmt.Errorf("unable to resize disk: %w", err))
 			return false
 		}
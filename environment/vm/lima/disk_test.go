@@ -0,0 +1,108 @@
+package lima
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/store"
+)
+
+func Test_newRuntimeDisk(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime string
+		disks   []string // existing lima disks
+		store   store.Store
+		want    runtimeDisk
+	}{
+		{name: "none runtime", runtime: "none", want: runtimeDisk{}},
+		{
+			name:    "new disk",
+			runtime: "docker",
+			want:    runtimeDisk{Required: true, Name: "colima", Create: true, Format: true, FSType: "ext4"},
+		},
+		{
+			name:    "existing unformatted disk",
+			runtime: "docker",
+			disks:   []string{"colima"},
+			want:    runtimeDisk{Required: true, Name: "colima", Format: true, FSType: "ext4"},
+		},
+		{
+			name:    "existing formatted disk",
+			runtime: "containerd",
+			disks:   []string{"colima"},
+			store:   store.Store{RuntimeDisks: map[string]store.RuntimeDisk{"containerd": {Name: "colima", Formatted: true}}},
+			want:    runtimeDisk{Required: true, Name: "colima", FSType: "ext4"},
+		},
+		{
+			name:    "disk formatted for another runtime",
+			runtime: "docker",
+			disks:   []string{"colima"},
+			store:   store.Store{RuntimeDisks: map[string]store.RuntimeDisk{"incus": {Name: "colima", Formatted: true}}},
+			want:    runtimeDisk{Required: true, Name: "colima-runtime-docker", Create: true, Format: true, FSType: "ext4"},
+		},
+		{
+			name:    "existing disk of another runtime",
+			runtime: "docker",
+			disks:   []string{"colima", "colima-runtime-docker"},
+			store: store.Store{RuntimeDisks: map[string]store.RuntimeDisk{
+				"incus":  {Name: "colima", Formatted: true},
+				"docker": {Name: "colima-runtime-docker", Formatted: true},
+			}},
+			want: runtimeDisk{Required: true, Name: "colima-runtime-docker", FSType: "ext4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasDisk := func(name string) bool { return slices.Contains(tt.disks, name) }
+			if got := newRuntimeDisk(config.Config{Runtime: tt.runtime}, hasDisk, tt.store); got != tt.want {
+				t.Errorf("newRuntimeDisk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dataDiskMountScript(t *testing.T) {
+	no := false
+	tests := []struct {
+		name    string
+		disk    config.DataDisk
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults",
+			disk:    config.DataDisk{Name: "db", Size: 20},
+			want:    []string{`DISK_NAME="colima-disk-db"`, `MOUNT_POINT="/mnt/db"`, "mkfs.ext4", `blkid "$DISK"`, "refusing to format"},
+			notWant: []string{"has no filesystem."},
+		},
+		{
+			name: "custom",
+			disk: config.DataDisk{Name: "db", Size: 20, FSType: "xfs", MountPoint: "/var/lib/postgresql"},
+			want: []string{`MOUNT_POINT="/var/lib/postgresql"`, "mkfs.xfs"},
+		},
+		{
+			name:    "not formatted",
+			disk:    config.DataDisk{Name: "db", Size: 20, Format: &no},
+			want:    []string{"has no filesystem."},
+			notWant: []string{"mkfs", "sfdisk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := dataDiskMountScript(tt.disk)
+			for _, s := range tt.want {
+				if !strings.Contains(script, s) {
+					t.Errorf("script does not contain %q:\n%s", s, script)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(script, s) {
+					t.Errorf("script contains %q:\n%s", s, script)
+				}
+			}
+		})
+	}
+}
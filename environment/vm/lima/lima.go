@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/store"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/abiosoft/colima/util/osutil"
 	"github.com/abiosoft/colima/util/yamlutil"
 	"github.com/sirupsen/logrus"
@@ -103,6 +105,14 @@ func (l *limaVM) Start(ctx context.Context, conf config.Config) error {
 		return l.createRuntimeDisk(conf)
 	})
 
+	a.Add(func() error {
+		if err := l.createDataDisks(ctx, conf); err != nil {
+			return err
+		}
+		l.attachDataDisks(conf)
+		return nil
+	})
+
 	a.Add(func() error {
 		return l.downloadDiskImage(ctx, conf)
 	})
@@ -126,7 +136,7 @@ func (l *limaVM) Start(ctx context.Context, conf config.Config) error {
 		return nil
 	})
 
-	l.addPostStartActions(a, conf)
+	l.addPostStartActions(ctx, a, conf)
 
 	return a.Exec()
 }
@@ -160,6 +170,14 @@ func (l *limaVM) resume(ctx context.Context, conf config.Config) error {
 		return nil
 	})
 
+	a.Add(func() error {
+		if err := l.createDataDisks(ctx, conf); err != nil {
+			return err
+		}
+		l.attachDataDisks(conf)
+		return nil
+	})
+
 	a.Add(l.setDiskImage)
 
 	a.Add(func() error {
@@ -176,6 +194,9 @@ func (l *limaVM) resume(ctx context.Context, conf config.Config) error {
 		err := yamlutil.WriteYAML(l.limaConf, config.CurrentProfile().LimaFile())
 		return err
 	})
+	if cli.RollbackStopsVM(ctx) {
+		a.Undo(restoreFile(config.CurrentProfile().LimaFile()))
+	}
 
 	a.Add(func() error { return l.writeNetworkFile(conf) })
 
@@ -184,7 +205,7 @@ func (l *limaVM) resume(ctx context.Context, conf config.Config) error {
 		return l.host.Run(limactl, "start", config.CurrentProfile().ID)
 	})
 
-	l.addPostStartActions(a, conf)
+	l.addPostStartActions(ctx, a, conf)
 
 	return a.Exec()
 }
@@ -295,7 +316,7 @@ func (l limaVM) Arch() environment.Arch {
 	return environment.Arch(a)
 }
 
-func (l *limaVM) addPostStartActions(a *cli.ActiveCommandChain, conf config.Config) {
+func (l *limaVM) addPostStartActions(ctx context.Context, a *cli.ActiveCommandChain, conf config.Config) {
 	// setup dns
 	a.Add(func() error {
 		if err := l.setupDNS(conf); err != nil {
@@ -348,22 +369,30 @@ func (l *limaVM) addPostStartActions(a *cli.ActiveCommandChain, conf config.Conf
 
 	// preserve state
 	a.Add(func() error {
-		if err := configmanager.SaveToFile(conf, config.CurrentProfile().StateFile()); err != nil {
+		if err := configmanager.SaveState(conf, config.CurrentProfile().StateFile()); err != nil {
 			logrus.Warnln(fmt.Errorf("error persisting Colima state: %w", err))
 		}
 		return nil
 	})
+	if cli.RollbackStopsVM(ctx) {
+		a.Undo(restoreFile(config.CurrentProfile().StateFile()))
+	}
 
 	// save store settings
 	a.Add(func() error {
-		if len(l.limaConf.AdditionalDisks) == 0 {
+		s, _ := store.Load()
+		name := limautil.RuntimeDiskName(s, conf.Runtime)
+		if !slices.ContainsFunc(l.limaConf.AdditionalDisks, func(d limaconfig.Disk) bool { return d.Name == name }) {
 			return nil
 		}
 
 		// startup is successful
-		// if additional disk is present, then it must've been formatted correctly.
+		// if the runtime disk is present, then it must've been formatted correctly.
 		if err := store.Set(func(s *store.Store) {
-			s.DiskFormatted = true
+			if s.RuntimeDisks == nil {
+				s.RuntimeDisks = map[string]store.RuntimeDisk{}
+			}
+			s.RuntimeDisks[conf.Runtime] = store.RuntimeDisk{Name: name, Formatted: true}
 		}); err != nil {
 			// not fatal, but should be logged
 			logrus.Warnln(fmt.Errorf("error persisting store settings: %w", err))
@@ -393,3 +422,23 @@ func (l *limaVM) prepareHost(conf config.Config) {
 
 	l.host = l.host.WithEnv(envLimaSSHPortForwarder + "=" + strconv.FormatBool(useSSHPortForwarder))
 }
+
+// restoreFile returns an undo action that restores the current content of file.
+// The file is removed instead if it does not currently exist.
+func restoreFile(file string) func() error {
+	b, err := os.ReadFile(file)
+	exists := err == nil
+
+	return func() error {
+		if !exists {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing %s: %w", file, err)
+			}
+			return nil
+		}
+		if err := fsutil.WriteFileAtomic(file, b, 0644); err != nil {
+			return fmt.Errorf("error restoring %s: %w", file, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package limautil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/util"
+)
+
+// CompactDiskImage rewrites the disk image to release the unused space on the host,
+// returning the space allocated on the host before and after in bytes.
+// Space freed within the VM is only released if it has been trimmed e.g. with fstrim.
+// The backing file of the image is retained, internal snapshots are not.
+// The instance must be stopped.
+func CompactDiskImage(file string) (before, after int64, err error) {
+	if err := util.AssertQemuImg(); err != nil {
+		return 0, 0, err
+	}
+
+	image, err := diskImageInfo(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	before = image.ActualSize
+
+	// zeroed and unallocated blocks are not written to the new image
+	args := []string{"convert", "-f", image.Format, "-O", image.Format}
+	if image.BackingFile != "" {
+		args = append(args, "-B", image.BackingFile)
+		if image.BackingFormat != "" {
+			args = append(args, "-F", image.BackingFormat)
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".compact")
+	_ = os.Remove(tmp)
+	if err := qemuImg(append(args, file, tmp)...); err != nil {
+		_ = os.Remove(tmp)
+		return before, before, fmt.Errorf("error compacting disk image: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return before, before, fmt.Errorf("error replacing disk image: %w", err)
+	}
+
+	image, err = diskImageInfo(file)
+	if err != nil {
+		return before, before, err
+	}
+	return before, image.ActualSize, nil
+}
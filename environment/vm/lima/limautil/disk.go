@@ -1,21 +1,53 @@
 package limautil
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/store"
 )
 
-// HasDisk checks if a lima disk exists for the current instance.
-func HasDisk() bool {
-	name := config.CurrentProfile().ID
+// DiskInfo is the information about a lima disk.
+type DiskInfo struct {
+	Name string `json:"name"`
+	// Size is the virtual size of the disk in bytes.
+	Size int64  `json:"size"`
+	Dir  string `json:"dir"`
+	// Instance is the instance the disk is attached to, if any.
+	Instance string `json:"instance"`
+}
+
+// RuntimeDiskName returns the name of the lima disk for the container runtime of the current instance.
+// The disk of the first runtime is named after the instance, as the single runtime disk
+// before each runtime had its own disk.
+func RuntimeDiskName(s store.Store, runtime string) string {
+	if d, ok := s.RuntimeDisks[runtime]; ok {
+		return d.Name
+	}
 
-	var resp struct {
-		Name string `json:"name"`
+	id := config.CurrentProfile().ID
+	for _, d := range s.RuntimeDisks {
+		if d.Name == id {
+			return id + "-runtime-" + runtime
+		}
 	}
+	return id
+}
+
+// HasRuntimeDisk checks if the lima disk for the container runtime of the current instance exists.
+func HasRuntimeDisk(s store.Store, runtime string) bool {
+	_, ok := Disk(RuntimeDiskName(s, runtime))
+	return ok
+}
+
+// Disk returns the lima disk with the name.
+func Disk(name string) (DiskInfo, bool) {
+	var resp DiskInfo
 
 	cmd := Limactl("disk", "list", "--json", name)
 	var buf bytes.Buffer
@@ -23,20 +55,48 @@ func HasDisk() bool {
 	cmd.Stderr = nil
 
 	if err := cmd.Run(); err != nil {
-		return false
+		return resp, false
 	}
 
 	if err := json.NewDecoder(&buf).Decode(&resp); err != nil {
-		return false
+		return resp, false
 	}
 
-	return resp.Name == name
+	return resp, resp.Name == name
 }
 
-// CreateDisk creates a lima disk with size in GiB.
-func CreateDisk(size int) error {
-	name := config.CurrentProfile().ID
+// DataDiskName returns the name of the lima disk for the data disk of the current instance.
+func DataDiskName(name string) string { return dataDiskPrefix() + name }
 
+func dataDiskPrefix() string { return config.CurrentProfile().ID + "-disk-" }
+
+// DataDisks returns the lima disks for the data disks of the current instance.
+func DataDisks() ([]DiskInfo, error) {
+	var buf bytes.Buffer
+	cmd := Limactl("disk", "list", "--json")
+	cmd.Stdout = &buf
+	cmd.Stderr = nil
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error retrieving disks: %w", err)
+	}
+
+	var disks []DiskInfo
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var d DiskInfo
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("error retrieving disks: %w", err)
+		}
+		if strings.HasPrefix(d.Name, dataDiskPrefix()) {
+			disks = append(disks, d)
+		}
+	}
+	return disks, nil
+}
+
+// CreateNamedDisk creates a lima disk with the name and size in GiB.
+func CreateNamedDisk(name string, size int) error {
 	var buf bytes.Buffer
 	cmd := Limactl("disk", "create", name, "--size", fmt.Sprintf("%dGiB", size))
 	cmd.Stderr = &buf
@@ -49,10 +109,8 @@ func CreateDisk(size int) error {
 	return nil
 }
 
-// ResizeDisk resizes disk to new size
-func ResizeDisk(size int) error {
-	name := config.CurrentProfile().ID
-
+// ResizeNamedDisk resizes the lima disk with the name to the size in GiB.
+func ResizeNamedDisk(name string, size int) error {
 	var buf bytes.Buffer
 	cmd := Limactl("disk", "resize", name, "--size", fmt.Sprintf("%dGiB", size))
 	cmd.Stderr = &buf
@@ -65,10 +123,8 @@ func ResizeDisk(size int) error {
 	return nil
 }
 
-// DeleteDisk deletes lima disk for the current instance.
-func DeleteDisk() error {
-	name := config.CurrentProfile().ID
-
+// DeleteDisk deletes the lima disk with the name.
+func DeleteDisk(name string) error {
 	var buf bytes.Buffer
 	cmd := Limactl("disk", "delete", name)
 	cmd.Stderr = &buf
@@ -81,15 +137,91 @@ func DeleteDisk() error {
 	return nil
 }
 
-// MountPoint returns the lima disk mount point for the current instance.
+// MountPoint returns the mount point of the runtime disk for the current instance.
+// It is the same for the disks of all runtimes, only one is attached at a time.
 func MountPoint() string { return fmt.Sprintf("/mnt/lima-%s", config.CurrentProfile().ID) }
 
 // DiskPrivisioned returns if the disk exists and has been provisioned for the specified runtime.
 func DiskProvisioned(runtime string) bool {
-	if !HasDisk() {
+	s, _ := store.Load()
+	d, ok := s.RuntimeDisks[runtime]
+	if !ok || !d.Formatted {
 		return false
 	}
 
-	s, _ := store.Load()
-	return s.DiskFormatted && s.DiskRuntime == runtime
+	_, ok = Disk(d.Name)
+	return ok
+}
+
+// FilesystemUsage is the usage of a filesystem in the VM.
+type FilesystemUsage struct {
+	MountPoint string `json:"mount_point"`
+	// Size and Used are in bytes.
+	Size int64 `json:"size"`
+	Used int64 `json:"used"`
+}
+
+// FilesystemUsages returns the usage of the filesystems of the paths in the VM of the
+// current instance, by mount point. Paths that do not exist are omitted.
+func FilesystemUsages(paths ...string) (map[string]FilesystemUsage, error) {
+	var buf bytes.Buffer
+	args := append([]string{"shell", config.CurrentProfile().ID, "df", "-B1", "--output=target,size,used"}, paths...)
+	cmd := Limactl(args...)
+	cmd.Stderr = nil
+	cmd.Stdout = &buf
+
+	// df fails for missing paths but reports the others
+	runErr := cmd.Run()
+
+	usages := map[string]FilesystemUsage{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var u FilesystemUsage
+		if _, err := fmt.Sscan(scanner.Text(), &u.MountPoint, &u.Size, &u.Used); err != nil {
+			// header
+			continue
+		}
+		usages[u.MountPoint] = u
+	}
+	if len(usages) == 0 && runErr != nil {
+		return nil, fmt.Errorf("error retrieving filesystem usage: %w", runErr)
+	}
+	return usages, nil
+}
+
+// DirectoryUsages returns the space used by the directories in the VM of the current instance
+// in bytes, by path. Directories that do not exist are omitted.
+func DirectoryUsages(paths ...string) (map[string]int64, error) {
+	var buf bytes.Buffer
+	args := append([]string{"shell", config.CurrentProfile().ID, "sudo", "du", "-sxb"}, paths...)
+	cmd := Limactl(args...)
+	cmd.Stderr = nil
+	cmd.Stdout = &buf
+
+	// du fails for missing paths but reports the others
+	runErr := cmd.Run()
+
+	usages := parseDirectoryUsages(&buf)
+	if len(usages) == 0 && runErr != nil {
+		return nil, fmt.Errorf("error retrieving directory usage: %w", runErr)
+	}
+	return usages, nil
+}
+
+// parseDirectoryUsages parses the output of 'du -sb', a size and path per line.
+func parseDirectoryUsages(r io.Reader) map[string]int64 {
+	usages := map[string]int64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		size, path, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		var used int64
+		if _, err := fmt.Sscan(size, &used); err != nil {
+			continue
+		}
+		usages[path] = used
+	}
+	return usages
 }
@@ -0,0 +1,40 @@
+package limautil
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func Test_parseDirectoryUsages(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]int64
+	}{
+		{name: "empty", output: "", want: map[string]int64{}},
+		{
+			name:   "directories",
+			output: "1024\t/var/lib/docker\n0\t/var/lib/cni\n",
+			want:   map[string]int64{"/var/lib/docker": 1024, "/var/lib/cni": 0},
+		},
+		{
+			name:   "errors are skipped",
+			output: "du: cannot access '/var/lib/ramalama': No such file or directory\n2048\t/var/lib/containerd\n",
+			want:   map[string]int64{"/var/lib/containerd": 2048},
+		},
+		{
+			name:   "path with spaces",
+			output: "4096\t/mnt/my data\n",
+			want:   map[string]int64{"/mnt/my data": 4096},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseDirectoryUsages(strings.NewReader(tt.output))
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseDirectoryUsages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -38,7 +38,7 @@ func (i InstanceInfo) Running() bool { return i.Status == limaStatusRunning }
 
 // Config returns the current Colima config
 func (i InstanceInfo) Config() (config.Config, error) {
-	return configmanager.LoadFrom(config.ProfileFromName(i.Name).StateFile())
+	return configmanager.LoadState(config.ProfileFromName(i.Name).StateFile())
 }
 
 // Lima statuses
@@ -0,0 +1,190 @@
+package limautil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/store"
+	"github.com/abiosoft/colima/util"
+)
+
+// DiskDir returns the directory of the lima disk with the name.
+func DiskDir(disk string) string { return filepath.Join(config.LimaDir(), "_disks", disk) }
+
+// DiskFile returns the path to the image of the lima disk with the name.
+func DiskFile(disk string) string { return filepath.Join(DiskDir(disk), "datadisk") }
+
+// diskSnapshotFile returns the path to an external snapshot of the disk. The snapshots are kept
+// in the disk directory, they are deleted along with the disk.
+func diskSnapshotFile(disk, name string) string {
+	return filepath.Join(DiskDir(disk), "snapshots", name)
+}
+
+// diskImage is the information about a disk image.
+type diskImage struct {
+	Format      string `json:"format"`
+	VirtualSize int64  `json:"virtual-size"`
+	// ActualSize is the space allocated on the host in bytes.
+	ActualSize    int64  `json:"actual-size"`
+	BackingFile   string `json:"full-backing-filename"`
+	BackingFormat string `json:"backing-filename-format"`
+}
+
+func diskImageInfo(file string) (d diskImage, err error) {
+	var buf bytes.Buffer
+	cmd := cli.Command("qemu-img", "info", "--output=json", file)
+	cmd.Stdout = &buf
+	cmd.Stderr = nil
+	if err := cmd.Run(); err != nil {
+		return d, fmt.Errorf("error retrieving disk image info: %w", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		return d, fmt.Errorf("error retrieving disk image info: %w", err)
+	}
+	return d, nil
+}
+
+func qemuImg(args ...string) error {
+	var buf bytes.Buffer
+	cmd := cli.Command("qemu-img", args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w, output: %s", err, buf.String())
+	}
+	return nil
+}
+
+// CreateDiskSnapshot creates a snapshot of the lima disk.
+// qcow2 disks are snapshotted internally, other formats are copied to an external snapshot.
+// The instance must be stopped.
+func CreateDiskSnapshot(disk, name string) (store.DiskSnapshot, error) {
+	snapshot := store.DiskSnapshot{Name: name, Created: time.Now()}
+	if err := util.AssertQemuImg(); err != nil {
+		return snapshot, err
+	}
+
+	image, err := diskImageInfo(DiskFile(disk))
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Size = image.VirtualSize
+
+	if image.Format == "qcow2" {
+		snapshot.Type = store.DiskSnapshotInternal
+		if err := qemuImg("snapshot", "-c", name, DiskFile(disk)); err != nil {
+			return snapshot, fmt.Errorf("error creating disk snapshot: %w", err)
+		}
+		return snapshot, nil
+	}
+
+	snapshot.Type = store.DiskSnapshotExternal
+	if err := os.MkdirAll(filepath.Dir(diskSnapshotFile(disk, name)), 0755); err != nil {
+		return snapshot, fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+	if err := copyDisk(DiskFile(disk), diskSnapshotFile(disk, name)); err != nil {
+		return snapshot, fmt.Errorf("error creating disk snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// RestoreDiskSnapshot reverts the lima disk to the snapshot.
+// The disk retains its current size if it has been resized since the snapshot.
+// The instance must be stopped.
+func RestoreDiskSnapshot(disk string, snapshot store.DiskSnapshot) error {
+	if err := util.AssertQemuImg(); err != nil {
+		return err
+	}
+
+	current, err := diskImageInfo(DiskFile(disk))
+	if err != nil {
+		return err
+	}
+
+	switch snapshot.Type {
+	case store.DiskSnapshotInternal:
+		if err := qemuImg("snapshot", "-a", snapshot.Name, DiskFile(disk)); err != nil {
+			return fmt.Errorf("error restoring disk snapshot: %w", err)
+		}
+	case store.DiskSnapshotExternal:
+		if err := copyDisk(diskSnapshotFile(disk, snapshot.Name), DiskFile(disk)); err != nil {
+			return fmt.Errorf("error restoring disk snapshot: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported disk snapshot type: '%s'", snapshot.Type)
+	}
+
+	restored, err := diskImageInfo(DiskFile(disk))
+	if err != nil {
+		return err
+	}
+	if restored.VirtualSize < current.VirtualSize {
+		size := fmt.Sprint(current.VirtualSize)
+		if err := qemuImg("resize", "-f", restored.Format, DiskFile(disk), size); err != nil {
+			return fmt.Errorf("error resizing restored disk: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteDiskSnapshot deletes the snapshot of the lima disk.
+func DeleteDiskSnapshot(disk string, snapshot store.DiskSnapshot) error {
+	switch snapshot.Type {
+	case store.DiskSnapshotInternal:
+		if err := util.AssertQemuImg(); err != nil {
+			return err
+		}
+		if err := qemuImg("snapshot", "-d", snapshot.Name, DiskFile(disk)); err != nil {
+			return fmt.Errorf("error deleting disk snapshot: %w", err)
+		}
+	case store.DiskSnapshotExternal:
+		if err := os.Remove(diskSnapshotFile(disk, snapshot.Name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error deleting disk snapshot: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported disk snapshot type: '%s'", snapshot.Type)
+	}
+	return nil
+}
+
+// copyDisk copies the disk image src to dst via a temporary file that replaces dst.
+// The copy is a clone on filesystems that support it, which is near instant.
+func copyDisk(src, dst string) error {
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	_ = os.Remove(tmp)
+
+	var buf bytes.Buffer
+	copyFile := func(args ...string) error {
+		buf.Reset()
+		cmd := cli.Command("cp", append(args, src, tmp)...)
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+		return cmd.Run()
+	}
+
+	var err error
+	if util.MacOS() {
+		// clonefile on APFS, otherwise a regular copy
+		if err = copyFile("-c"); err != nil {
+			err = copyFile()
+		}
+	} else {
+		err = copyFile("--reflink=auto", "--sparse=always")
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error copying disk: %w, output: %s", err, buf.String())
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error copying disk: %w", err)
+	}
+	return nil
+}
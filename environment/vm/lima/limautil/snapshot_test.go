@@ -0,0 +1,34 @@
+package limautil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_copyDisk(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "datadisk")
+	dst := filepath.Join(dir, "snapshot")
+
+	for _, content := range []string{"first", "second"} {
+		if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// an existing copy is replaced
+		if err := copyDisk(src, dst); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := os.ReadFile(dst); err != nil || string(b) != content {
+			t.Errorf("unexpected copy: %q, %v", b, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected no temporary files, got %v", entries)
+	}
+}
@@ -0,0 +1,86 @@
+package lima
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/store"
+)
+
+func (l *limaVM) Plan(ctx context.Context, conf config.Config) (p environment.VMPlan, err error) {
+	// work on a copy to leave the receiver untouched
+	vm := *l
+	vm.prepareHost(conf)
+
+	if daemonConf, required := daemonConfig(conf); required {
+		p.Daemon, err = vm.daemon.Command(daemonConf)
+		if err != nil {
+			return p, fmt.Errorf("error computing daemon command: %w", err)
+		}
+	}
+
+	s, _ := store.Load()
+
+	if vm.Created() {
+		p.Action = "resume"
+
+		// disk resize is only applied at startup, report the intended size
+		if instance, err := configmanager.LoadInstance(); err == nil && conf.Disk < instance.Disk {
+			conf.Disk = instance.Disk
+		}
+
+		vm.limaConf, err = newConf(ctx, conf)
+		if err != nil {
+			return p, err
+		}
+
+		disk := existingRuntimeDisk(conf, hasDisk, s)
+		if disk.Required {
+			vm.attachRuntimeDisk(conf, disk)
+		} else {
+			vm.limaConf.Disk = config.Disk(conf.Disk).GiB()
+		}
+		p.RuntimeDisk = disk.String()
+
+		if err := vm.setDiskImage(); err != nil {
+			return p, fmt.Errorf("error reading disk image of existing instance: %w", err)
+		}
+	} else {
+		p.Action = "create"
+
+		vm.limaConf, err = newConf(ctx, conf)
+		if err != nil {
+			return p, err
+		}
+
+		disk := newRuntimeDisk(conf, hasDisk, s)
+		if disk.Required {
+			vm.attachRuntimeDisk(conf, disk)
+		}
+		p.RuntimeDisk = disk.String()
+		if disk.Create {
+			p.RuntimeDisk += fmt.Sprintf(" (%s)", config.Disk(conf.Disk).GiB())
+		}
+
+		// the disk image is resolved at startup, possibly requiring a download
+		if image, err := limautil.Image(vm.limaConf.Arch, conf.Runtime); err == nil {
+			if cached, ok := limautil.ImageCached(vm.limaConf.Arch, conf.Runtime, conf.DiskImageMirror); ok {
+				image = cached
+			}
+			if conf.DiskImage != "" {
+				image.Location = conf.DiskImage
+			}
+			vm.limaConf.Images = append(vm.limaConf.Images, image)
+		}
+	}
+
+	vm.attachDataDisks(conf)
+	p.DataDisks = dataDisksPlan(conf)
+
+	p.Config = vm.limaConf
+	return p, nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/fsutil"
+)
+
+// maxHistory is the number of history entries retained per profile.
+const maxHistory = 500
+
+// History outcomes.
+const (
+	HistoryOutcomeSuccess = "success"
+	HistoryOutcomeFailure = "failure"
+)
+
+// HistoryEntry is a lifecycle command of an instance e.g. start, stop.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	// Duration is the duration of the command in milliseconds.
+	Duration int64          `json:"duration"`
+	Stages   []HistoryStage `json:"stages,omitempty"`
+
+	ColimaVersion     string `json:"colima_version"`
+	Runtime           string `json:"runtime,omitempty"`
+	RuntimeVersion    string `json:"runtime_version,omitempty"`
+	KubernetesVersion string `json:"kubernetes_version,omitempty"`
+}
+
+// HistoryStage is a stage of a lifecycle command.
+type HistoryStage struct {
+	Context string `json:"context"`
+	Stage   string `json:"stage"`
+	// Duration is the duration of the stage in milliseconds.
+	Duration int64 `json:"duration"`
+	Failed   bool  `json:"failed,omitempty"`
+}
+
+// Slowest returns the slowest stage of the entry.
+func (h HistoryEntry) Slowest() (HistoryStage, bool) {
+	var slowest HistoryStage
+	for _, s := range h.Stages {
+		if s.Duration > slowest.Duration {
+			slowest = s
+		}
+	}
+	return slowest, slowest.Stage != ""
+}
+
+func historyFile() string { return config.CurrentProfile().HistoryFile() }
+
+// History returns the lifecycle history of the current profile, oldest first.
+func History() ([]HistoryEntry, error) {
+	return loadHistory(historyFile())
+}
+
+func loadHistory(file string) ([]HistoryEntry, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read history file: %w", err)
+	}
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		// a corrupted entry does not invalidate the others
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// AppendHistory appends the entry to the lifecycle history of the current profile.
+// Only the latest entries are retained.
+func AppendHistory(e HistoryEntry) error {
+	return appendHistory(historyFile(), e)
+}
+
+func appendHistory(file string, e HistoryEntry) error {
+	unlock, err := fsutil.Lock(file)
+	if err != nil {
+		return fmt.Errorf("error locking history: %w", err)
+	}
+	defer unlock()
+
+	entries, err := loadHistory(file)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, e)
+	if len(entries) > maxHistory {
+		entries = entries[len(entries)-maxHistory:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("error marshaling history: %w", err)
+		}
+	}
+	if err := fsutil.WriteFileAtomic(file, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+
+	for i := range maxHistory + 2 {
+		e := HistoryEntry{Time: time.Unix(int64(i), 0), Command: "start", Outcome: HistoryOutcomeSuccess}
+		if err := appendHistory(file, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a corrupted entry does not invalidate the others
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{\"time\": \n")
+	_ = f.Close()
+
+	entries, err := loadHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != maxHistory {
+		t.Fatalf("expected %d entries, got %d", maxHistory, len(entries))
+	}
+	if first := entries[0].Time.Unix(); first != 2 {
+		t.Errorf("expected the oldest entries to be dropped, first entry at %d", first)
+	}
+}
+
+func TestHistoryEntrySlowest(t *testing.T) {
+	e := HistoryEntry{Stages: []HistoryStage{
+		{Context: "vm", Stage: "creating", Duration: 200},
+		{Context: "vm", Stage: "starting", Duration: 4500},
+		{Context: "docker", Stage: "provisioning", Duration: 300},
+	}}
+	if s, ok := e.Slowest(); !ok || s.Stage != "starting" {
+		t.Errorf("unexpected slowest stage: %+v", s)
+	}
+	if _, ok := (HistoryEntry{}).Slowest(); ok {
+		t.Errorf("expected no slowest stage without stages")
+	}
+}
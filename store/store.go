@@ -2,47 +2,185 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/sirupsen/logrus"
 )
 
+// Version is the version of the store format.
+const Version = 1
+
 // Store stores internal Colima configuration for an instance
 type Store struct {
+	// the version of the store format, 0 for stores created before versioning
+	Version int `json:"version"`
 	// if the runtime disk has been formatted.
+	// Deprecated: only read for stores created before RuntimeDisks.
 	DiskFormatted bool `json:"disk_formatted"`
 	// the container runtime the disk is provisioned for
+	// Deprecated: only read for stores created before RuntimeDisks.
 	DiskRuntime string `json:"disk_runtime"`
+	// the runtime disks by container runtime, a runtime has its own disk
+	RuntimeDisks map[string]RuntimeDisk `json:"runtime_disks,omitempty"`
 	// if ramalama has been provisioned in the VM
 	RamalamaProvisioned bool `json:"ramalama_provisioned"`
+	// hashes of the run-once provision scripts that have succeeded in the VM
+	ProvisionedScripts []string `json:"provisioned_scripts,omitempty"`
+	// results of the provision scripts from the last startup
+	ProvisionResults []ProvisionResult `json:"provision_results,omitempty"`
+	// containers drained on stop to be started on next startup, by runtime
+	DrainedContainers map[string][]string `json:"drained_containers,omitempty"`
+	// snapshots of the runtime disk, oldest first
+	DiskSnapshots []DiskSnapshot `json:"disk_snapshots,omitempty"`
+}
+
+// RuntimeDisk is the data disk of a container runtime.
+type RuntimeDisk struct {
+	// Name is the name of the Lima disk.
+	Name string `json:"name"`
+	// if the disk has been formatted.
+	Formatted bool `json:"formatted"`
+}
+
+// Disk snapshot types.
+const (
+	DiskSnapshotInternal = "internal" // a qcow2 snapshot within the disk image
+	DiskSnapshotExternal = "external" // a copy of the disk image
+)
+
+// DiskSnapshot is a snapshot of the runtime disk.
+type DiskSnapshot struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Created time.Time `json:"created"`
+	// the container runtime the disk was provisioned for
+	Runtime string `json:"runtime,omitempty"`
+	// Size is the virtual size of the disk in bytes.
+	Size int64 `json:"size,omitempty"`
+}
+
+// DiskSnapshot returns the snapshot of the runtime disk with the name.
+func (s Store) DiskSnapshot(name string) (DiskSnapshot, bool) {
+	for _, snapshot := range s.DiskSnapshots {
+		if snapshot.Name == name {
+			return snapshot, true
+		}
+	}
+	return DiskSnapshot{}, false
+}
+
+// Provision script statuses.
+const (
+	ProvisionStatusOK      = "ok"
+	ProvisionStatusFailed  = "failed"
+	ProvisionStatusTimeout = "timeout"
+	ProvisionStatusSkipped = "skipped" // a dependency did not succeed
+	ProvisionStatusDone    = "done"    // a run-once script that has already succeeded
+)
+
+// ProvisionResult is the result of a provision script.
+type ProvisionResult struct {
+	Name   string `json:"name"`
+	Mode   string `json:"mode"`
+	Status string `json:"status"`
+	// Duration is the duration of the script in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Succeeded returns if the script succeeded, currently or previously.
+func (p ProvisionResult) Succeeded() bool {
+	return p.Status == ProvisionStatusOK || p.Status == ProvisionStatusDone
 }
 
 func storeFile() string { return config.CurrentProfile().StoreFile() }
 
+// errCorrupted is returned for a store file that cannot be decoded.
+var errCorrupted = errors.New("store file is corrupted")
+
 // Load loads the store from the json file.
+// A corrupted store is recovered from its backup, or reset if there is none.
 func Load() (s Store, err error) {
-	b, err := os.ReadFile(storeFile())
+	s, err = load(storeFile())
+	if !errors.Is(err, errCorrupted) {
+		return s, err
+	}
+
+	unlock, err := fsutil.Lock(storeFile())
+	if err != nil {
+		return s, err
+	}
+	defer unlock()
+
+	// may have been recovered by another process while waiting for the lock
+	if s, err := load(storeFile()); !errors.Is(err, errCorrupted) {
+		return s, err
+	}
+	return recoverStore(storeFile())
+}
+
+func load(file string) (s Store, err error) {
+	b, err := os.ReadFile(file)
 	if err != nil {
 		return s, fmt.Errorf("cannot read store file: %w", err)
 	}
 
 	if err := json.Unmarshal(b, &s); err != nil {
-		return s, fmt.Errorf("error unmarshaling store file: %w", err)
+		return s, fmt.Errorf("%w: %w", errCorrupted, err)
+	}
+	if s.Version > Version {
+		return s, fmt.Errorf("store version %d is not supported by this version of colima, upgrade colima to the latest version", s.Version)
+	}
+
+	// stores before per-runtime disks have a single runtime disk named after the profile
+	if len(s.RuntimeDisks) == 0 && s.DiskFormatted && s.DiskRuntime != "" {
+		s.RuntimeDisks = map[string]RuntimeDisk{
+			s.DiskRuntime: {Name: config.CurrentProfile().ID, Formatted: true},
+		}
 	}
 
 	return s, nil
 }
 
-// save persists the store.
+// recoverStore replaces the corrupted store file with its backup, or an empty store if
+// there is no valid backup. The corrupted file is retained for inspection.
+// The lock of the store file must be held.
+func recoverStore(file string) (Store, error) {
+	s, err := load(fsutil.BackupFile(file))
+	if err != nil {
+		s = Store{}
+		logrus.Warnf("store file '%s' is corrupted and has been reset", file)
+	} else {
+		logrus.Warnf("store file '%s' is corrupted and has been recovered from backup", file)
+	}
+
+	if err := os.Rename(file, file+".corrupted"); err != nil {
+		return s, fmt.Errorf("error moving corrupted store file: %w", err)
+	}
+	if err := save(s); err != nil {
+		return s, fmt.Errorf("error saving recovered store: %w", err)
+	}
+	return s, nil
+}
+
+// save persists the store, the previous store is kept as a backup.
+// The lock of the store file must be held.
 func save(s Store) error {
+	s.Version = Version
 	b, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling store: %w", err)
 	}
 
-	if err := os.WriteFile(storeFile(), b, 0o644); err != nil {
+	if err := fsutil.Backup(storeFile()); err != nil {
+		logrus.Debugln(err)
+	}
+	if err := fsutil.WriteFileAtomic(storeFile(), b, 0o644); err != nil {
 		return fmt.Errorf("error writing store file: %w", err)
 	}
 
@@ -50,8 +188,18 @@ func save(s Store) error {
 }
 
 // Set provides an easy way to set a value in the store.
+// The store file is locked for the duration, concurrent updates are not lost.
 func Set(f func(*Store)) error {
-	s, err := Load()
+	unlock, err := fsutil.Lock(storeFile())
+	if err != nil {
+		return fmt.Errorf("error locking store: %w", err)
+	}
+	defer unlock()
+
+	s, err := load(storeFile())
+	if errors.Is(err, errCorrupted) {
+		s, err = recoverStore(storeFile())
+	}
 	if err != nil {
 		logrus.Debug("error loading store: %w", err)
 	}
@@ -67,11 +215,22 @@ func Set(f func(*Store)) error {
 
 // Reset resets the values in the store to the defaults.
 func Reset() error {
+	unlock, err := fsutil.Lock(storeFile())
+	if err != nil {
+		return fmt.Errorf("error locking store: %w", err)
+	}
+	defer unlock()
+
+	// the backup must not be recovered for a new instance
+	if err := os.Remove(fsutil.BackupFile(storeFile())); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing store backup: %w", err)
+	}
+
 	// first attempt to remove store file
-	if err := os.Remove(storeFile()); err != nil {
+	if err := os.Remove(storeFile()); err != nil && !os.IsNotExist(err) {
 		// if it fails
 		// then attempt to set it to empty value
-		return Set(func(s *Store) { *s = Store{} })
+		return save(Store{})
 	}
 
 	return nil
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRuntimeDisks(t *testing.T) {
+	tests := []struct {
+		name  string
+		store string
+		want  map[string]RuntimeDisk
+	}{
+		{
+			name:  "single runtime disk",
+			store: `{"disk_formatted": true, "disk_runtime": "docker"}`,
+			want:  map[string]RuntimeDisk{"docker": {Name: "colima", Formatted: true}},
+		},
+		{
+			name:  "unformatted disk",
+			store: `{"disk_formatted": false, "disk_runtime": ""}`,
+		},
+		{
+			name:  "runtime disks",
+			store: `{"disk_formatted": true, "disk_runtime": "docker", "runtime_disks": {"incus": {"name": "colima-runtime-incus", "formatted": true}}}`,
+			want:  map[string]RuntimeDisk{"incus": {Name: "colima-runtime-incus", Formatted: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "colima.json")
+			if err := os.WriteFile(file, []byte(tt.store), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := load(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.RuntimeDisks) != len(tt.want) {
+				t.Fatalf("unexpected runtime disks: %v, want %v", s.RuntimeDisks, tt.want)
+			}
+			for runtime, d := range tt.want {
+				if s.RuntimeDisks[runtime] != d {
+					t.Errorf("unexpected runtime disk for %s: %v, want %v", runtime, s.RuntimeDisks[runtime], d)
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/util/terminal"
 )
 
@@ -51,7 +52,7 @@ func (c *curlDownloader) Download(r Request, destPath string) error {
 	}
 
 	cmd := exec.Command("curl", args...)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = cli.Stdout()
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
@@ -0,0 +1,83 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteFileAtomic writes data to the file via a temporary file in the same directory
+// that is renamed to the file. Readers never observe a partially written file.
+// A symlinked file is written through, the target of the link is replaced.
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		file = target
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("error setting file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error replacing file: %w", err)
+	}
+	return nil
+}
+
+// BackupFile returns the backup file of the file, see Backup.
+func BackupFile(file string) string { return file + ".bak" }
+
+// Backup preserves the current content of the file as the backup file,
+// to recover from a corrupted file. It is a no-op if the file does not exist.
+// The backup is a hard link, the file must only be replaced with WriteFileAtomic.
+func Backup(file string) error {
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	// the content of a symlinked file is backed up, not the link
+	source := file
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		source = target
+	}
+	// linked to a temporary file that is renamed, to replace an existing backup atomically
+	tmp := filepath.Join(filepath.Dir(file), fmt.Sprintf(".%s.bak-%d", filepath.Base(file), os.Getpid()))
+	_ = os.Remove(tmp)
+	if err := os.Link(source, tmp); err != nil {
+		return fmt.Errorf("error creating backup file: %w", err)
+	}
+	if err := os.Rename(tmp, BackupFile(file)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error creating backup file: %w", err)
+	}
+	return nil
+}
+
+// AllocatedSize returns the space allocated on disk for the file in bytes,
+// which is less than its size for sparse files e.g. disk images.
+func AllocatedSize(file string) (int64, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return int64(sys.Blocks) * 512, nil
+	}
+	return stat.Size(), nil
+}
@@ -0,0 +1,127 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+
+	if err := WriteFileAtomic(file, []byte("one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(file, []byte("two"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for f, want := range map[string]string{file: "two", BackupFile(file): "one"} {
+		if b, err := os.ReadFile(f); err != nil || string(b) != want {
+			t.Errorf("unexpected content of %s: %q, %v", f, b, err)
+		}
+	}
+	if stat, err := os.Stat(file); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("unexpected permissions of %s: %v, %v", file, stat.Mode().Perm(), err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only the file and its backup, got %v", entries)
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "colima.yaml")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "colima.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Lstat(link); err != nil || stat.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected %s to remain a symlink: %v", link, err)
+	}
+	if b, err := os.ReadFile(target); err != nil || string(b) != "two" {
+		t.Errorf("unexpected content of %s: %q, %v", target, b, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(file, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent read-modify-write cycles are not lost while holding the lock
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := Lock(file)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+
+			b, _ := os.ReadFile(file)
+			n, _ := strconv.Atoi(string(b))
+			if err := WriteFileAtomic(file, []byte(strconv.Itoa(n+1)), 0644); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if b, _ := os.ReadFile(file); string(b) != "20" {
+		t.Errorf("expected 20 updates, got %s", b)
+	}
+}
+
+func TestLockPathNoWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.lock")
+
+	unlock, err := LockPath(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock is per open file, a second lock is held by the first
+	var held HeldError
+	if _, err := LockPath(path, false); !errors.As(err, &held) {
+		t.Fatalf("expected HeldError, got %v", err)
+	}
+	if held.Holder == nil || held.Holder.PID != os.Getpid() {
+		t.Errorf("unexpected holder: %v", held.Holder)
+	}
+
+	unlock()
+	if _, ok := Holder(path); ok {
+		t.Error("expected no holder after unlock")
+	}
+	unlock, err = LockPath(path, false)
+	if err != nil {
+		t.Fatalf("expected lock after unlock, got %v", err)
+	}
+	unlock()
+}
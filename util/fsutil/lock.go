@@ -0,0 +1,115 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Lock acquires an exclusive lock of the file, waiting until it is released by other processes.
+// The lock is held on a separate lock file, as the file may be replaced by WriteFileAtomic.
+// The returned function releases the lock.
+func Lock(file string) (unlock func(), err error) {
+	unlock, err = LockPath(filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".lock"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error locking '%s': %w", file, err)
+	}
+	return unlock, nil
+}
+
+// LockHolder is the process holding a lock.
+type LockHolder struct {
+	PID     int
+	Command string
+}
+
+func (l LockHolder) String() string {
+	if l.Command == "" {
+		return fmt.Sprintf("PID %d", l.PID)
+	}
+	return fmt.Sprintf("'%s' (PID %d)", l.Command, l.PID)
+}
+
+// HeldError is returned by LockPath if the lock is held by another process.
+type HeldError struct {
+	// Holder is the process holding the lock, if known.
+	Holder *LockHolder
+}
+
+func (h HeldError) Error() string {
+	if h.Holder == nil {
+		return "locked by another process"
+	}
+	return "locked by " + h.Holder.String()
+}
+
+// LockPath acquires an exclusive lock of the lock file at path.
+// If wait is false, a HeldError is returned instead of waiting for another process to release the lock.
+// The current process is recorded in the lock file as the holder, see Holder.
+// The returned function releases the lock.
+func LockPath(path string, wait bool) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			holder, ok := Holder(path)
+			if !ok {
+				return nil, HeldError{}
+			}
+			return nil, HeldError{Holder: &holder}
+		}
+		return nil, err
+	}
+
+	// the holder is informational, the lock is valid regardless
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"+command()+"\n"), 0)
+	}
+
+	return func() {
+		_ = f.Truncate(0)
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
+
+// Holder returns the process holding the lock file at path, as recorded by LockPath.
+func Holder(path string) (LockHolder, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return LockHolder{}, false
+	}
+	pid, cmd, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return LockHolder{}, false
+	}
+	return LockHolder{PID: n, Command: strings.TrimSpace(cmd)}, true
+}
+
+// command returns the command line of the current process, with the executable name only.
+func command() string {
+	if len(os.Args) == 0 {
+		return ""
+	}
+	args := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	return strings.Join(args, " ")
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/abiosoft/colima/cli"
 	"github.com/fatih/color"
 	"golang.org/x/term"
 )
@@ -42,7 +43,7 @@ func NewVerboseWriter(lineHeight int) io.WriteCloser {
 func (v *verboseWriter) Write(p []byte) (n int, err error) {
 	// if it's not a terminal, simply write to stdout
 	if !isTerminal {
-		return os.Stdout.Write(p)
+		return cli.Stdout().Write(p)
 	}
 
 	v.Lock()
@@ -0,0 +1,258 @@
+package yamlutil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AppendIndex is the path element to append to a sequence.
+const AppendIndex = "[+]"
+
+// ReadNode reads the yaml file as a document node, preserving comments and ordering.
+// The root mapping of the document is the only content of the node,
+// an empty mapping if the file is empty or does not exist.
+func ReadNode(file string) (*yaml.Node, error) {
+	b, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading yaml file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding yaml file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error decoding yaml file: not a mapping")
+	}
+	return &doc, nil
+}
+
+// EncodeNode encodes the document node as yaml.
+func EncodeNode(doc *yaml.Node) ([]byte, error) {
+	restoreBlankLines(doc.Content[0])
+
+	b, err := encode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding yaml file: %w", err)
+	}
+	return b, nil
+}
+
+// WriteNode writes the document node to the yaml file.
+func WriteNode(doc *yaml.Node, file string) error {
+	b, err := EncodeNode(doc)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(file, b); err != nil {
+		return fmt.Errorf("error writing yaml file: %w", err)
+	}
+	return nil
+}
+
+// LookupNode returns the node at the path.
+// Path elements are mapping keys or sequence indexes.
+func LookupNode(node *yaml.Node, path []string) (*yaml.Node, bool) {
+	for _, key := range path {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			_, value := mappingEntry(node, key)
+			if value == nil {
+				return nil, false
+			}
+			node = value
+		case yaml.SequenceNode:
+			i, ok := sequenceIndex(node, key)
+			if !ok {
+				return nil, false
+			}
+			node = node.Content[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// WalkNode calls fn for each value in the mapping or sequence node and their children, parents first.
+// The values are keyed by their dotted keys, prefixed with prefix if not empty,
+// list items are keyed by their index and have no key node.
+// The children of a value are not walked if fn returns false. Aliases are walked as the node they refer to.
+func WalkNode(prefix string, node *yaml.Node, fn func(key string, parent, keyNode, value *yaml.Node) bool) {
+	dotted := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := dotted(node.Content[i].Value)
+			if fn(key, node, node.Content[i], node.Content[i+1]) {
+				WalkNode(key, node.Content[i+1], fn)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := dotted(strconv.Itoa(i))
+			if fn(key, node, nil, item) {
+				WalkNode(key, item, fn)
+			}
+		}
+	}
+}
+
+// NodeValues returns the values in the mapping or sequence node and their children by their dotted keys.
+func NodeValues(node *yaml.Node) map[string]*yaml.Node {
+	values := map[string]*yaml.Node{}
+	WalkNode("", node, func(key string, _, _, value *yaml.Node) bool {
+		values[key] = value
+		return true
+	})
+	return values
+}
+
+// SetNode sets the value of the node at the path, the comments of an existing node are retained.
+// Missing mappings and sequences in the path are created, null values are replaced.
+// The AppendIndex path element appends to a sequence.
+func SetNode(node *yaml.Node, path []string, value *yaml.Node) error {
+	for i, key := range path {
+		last := i == len(path)-1
+
+		var child *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			if key == AppendIndex {
+				return fmt.Errorf("cannot append to '%s': not a list", pathString(path[:i]))
+			}
+			if _, child = mappingEntry(node, key); child == nil {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+				node.Style = 0 // empty flow mappings would remain inline
+			}
+		case yaml.SequenceNode:
+			if key == AppendIndex {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+				node.Content = append(node.Content, child)
+				if len(node.Content) == 1 {
+					node.Style = 0 // empty flow sequences would remain inline
+				}
+				break
+			}
+			index, ok := sequenceIndex(node, key)
+			if !ok {
+				return fmt.Errorf("invalid index '%s' of '%s': list has %d items", key, pathString(path[:i]), len(node.Content))
+			}
+			child = node.Content[index]
+		default:
+			return fmt.Errorf("cannot set '%s': '%s' is not a mapping or list", pathString(path), pathString(path[:i]))
+		}
+
+		if last {
+			resetNode(value)
+			value.HeadComment, value.LineComment, value.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			*child = *value
+			return nil
+		}
+
+		// null values are replaced with the expected collection
+		if child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+			if next := path[i+1]; next == AppendIndex {
+				*child = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", HeadComment: child.HeadComment, LineComment: child.LineComment}
+			} else {
+				*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: child.HeadComment, LineComment: child.LineComment}
+			}
+		}
+		node = child
+	}
+	return nil
+}
+
+// UnsetNode removes the node at the path and returns if it was present.
+func UnsetNode(node *yaml.Node, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	parent, ok := LookupNode(node, path[:len(path)-1])
+	if !ok {
+		return false
+	}
+
+	key := path[len(path)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i].Value == key {
+				parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+				return true
+			}
+		}
+	case yaml.SequenceNode:
+		if i, ok := sequenceIndex(parent, key); ok {
+			parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// resetNode resets the position and the flow style of the node and its children,
+// as the node is from a different document.
+func resetNode(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	if node.Kind != yaml.ScalarNode {
+		node.Style = 0
+	}
+	for _, n := range node.Content {
+		resetNode(n)
+	}
+}
+
+func mappingEntry(node *yaml.Node, key string) (k, v *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func sequenceIndex(node *yaml.Node, key string) (int, bool) {
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i >= len(node.Content) {
+		return 0, false
+	}
+	return i, true
+}
+
+func pathString(path []string) string {
+	var s string
+	for _, p := range path {
+		if _, err := strconv.Atoi(p); err == nil || p == AppendIndex {
+			if p != AppendIndex {
+				p = "[" + p + "]"
+			}
+			s += p
+			continue
+		}
+		if s != "" {
+			s += "."
+		}
+		s += p
+	}
+	return s
+}
@@ -3,13 +3,12 @@ package yamlutil
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"reflect"
-	"strconv"
 	"strings"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/util/fsutil"
 	"gopkg.in/yaml.v3"
 )
 
@@ -20,7 +19,7 @@ func WriteYAML(value any, file string) error {
 		return fmt.Errorf("error encoding YAML: %w", err)
 	}
 
-	return os.WriteFile(file, b, 0644)
+	return writeFile(file, b)
 }
 
 // Save saves the config.
@@ -29,13 +28,25 @@ func Save(c config.Config, file string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(file, b, 0644); err != nil {
+	if err := writeFile(file, b); err != nil {
 		return fmt.Errorf("error writing yaml file: %w", err)
 	}
 
 	return nil
 }
 
+// writeFile replaces the file atomically while holding its lock,
+// concurrent writers and readers never observe a partially written file.
+func writeFile(file string, b []byte) error {
+	unlock, err := fsutil.Lock(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fsutil.WriteFileAtomic(file, b, 0644)
+}
+
 func encodeYAML(conf config.Config) ([]byte, error) {
 	var doc yaml.Node
 
@@ -54,10 +65,8 @@ func encodeYAML(conf config.Config) ([]byte, error) {
 	root := doc.Content[0]
 
 	// get all nodes
-	nodeVals := map[string]*yaml.Node{}
-	if err := traverseNode("", root, nodeVals); err != nil {
-		return nil, fmt.Errorf("error traversing yaml node: %w", err)
-	}
+	restoreBlankLines(root)
+	nodeVals := NodeValues(root)
 
 	// get all node values
 	structVals := map[string]any{}
@@ -137,50 +146,15 @@ func traverseConfig(parentKey string, s any, vals map[string]any) {
 
 }
 
-func traverseNode(parentKey string, node *yaml.Node, vals map[string]*yaml.Node) error {
-	switch node.Kind {
-	case yaml.MappingNode:
-		if l := len(node.Content); l%2 != 0 {
-			return fmt.Errorf("uneven children of %d found for mapping node", l)
-		}
-		for i := 0; i < len(node.Content); i += 2 {
-			if i > 1 {
-				// fix jumbled comments
-				if cn := node.Content[i]; cn.HeadComment != "" {
-					if strings.Index(cn.HeadComment, "#") == 0 {
-						cn.HeadComment = "\n" + cn.HeadComment
-					}
-				}
-			}
-
-			key := node.Content[i].Value
-			val := node.Content[i+1]
-			if parentKey != "" {
-				key = parentKey + "." + key
-			}
-			vals[key] = val
-
-			if err := traverseNode(key, val, vals); err != nil {
-				return err
-			}
-		}
-	case yaml.SequenceNode:
-		for i := 0; i < len(node.Content); i++ {
-			key := strconv.Itoa(i)
-			val := node.Content[i]
-			if parentKey != "" {
-				key = parentKey + "." + key
-			}
-			vals[key] = val
-
-			if err := traverseNode(key, val, vals); err != nil {
-				return err
-			}
+// restoreBlankLines restores the blank lines before the comments of the keys of the node,
+// except the first key of each mapping.
+func restoreBlankLines(node *yaml.Node) {
+	WalkNode("", node, func(_ string, parent, key, _ *yaml.Node) bool {
+		if key != nil && key != parent.Content[0] && strings.Index(key.HeadComment, "#") == 0 {
+			key.HeadComment = "\n" + key.HeadComment
 		}
-	}
-
-	// yaml.ScalarNode has nothing to do
-	return nil
+		return true
+	})
 }
 
 func encode(v any) ([]byte, error) {
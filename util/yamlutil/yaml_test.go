@@ -43,3 +43,96 @@ func Test_encode_Docker(t *testing.T) {
 		})
 	}
 }
+
+func TestSetNode(t *testing.T) {
+	const file = `# the cpus
+cpu: 2 # inline
+docker: {}
+list: [a]
+`
+	tests := []struct {
+		name    string
+		path    []string
+		value   string
+		unset   bool
+		want    string
+		wantErr bool
+	}{
+		{name: "replace", path: []string{"cpu"}, value: "4", want: "# the cpus\ncpu: 4 # inline\ndocker: {}\nlist: [a]\n"},
+		{name: "nested", path: []string{"docker", "insecure-registries", AppendIndex}, value: "reg:5000",
+			want: "# the cpus\ncpu: 2 # inline\ndocker:\n  insecure-registries:\n    - reg:5000\nlist: [a]\n"},
+		{name: "append", path: []string{"list", AppendIndex}, value: "b", want: "# the cpus\ncpu: 2 # inline\ndocker: {}\nlist: [a, b]\n"},
+		{name: "index", path: []string{"list", "0"}, value: "b", want: "# the cpus\ncpu: 2 # inline\ndocker: {}\nlist: [b]\n"},
+		{name: "new key", path: []string{"memory"}, value: "8", want: "# the cpus\ncpu: 2 # inline\ndocker: {}\nlist: [a]\nmemory: 8\n"},
+		{name: "unset", path: []string{"list", "0"}, unset: true, want: "# the cpus\ncpu: 2 # inline\ndocker: {}\nlist: []\n"},
+		{name: "invalid index", path: []string{"list", "1"}, value: "b", wantErr: true},
+		{name: "append to mapping", path: []string{"docker", AppendIndex}, value: "b", wantErr: true},
+		{name: "scalar", path: []string{"cpu", "count"}, value: "b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(file), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if tt.unset {
+				if !UnsetNode(doc.Content[0], tt.path) {
+					t.Fatalf("UnsetNode() did not find %v", tt.path)
+				}
+			} else {
+				var value yaml.Node
+				if err := yaml.Unmarshal([]byte(tt.value), &value); err != nil {
+					t.Fatal(err)
+				}
+				err := SetNode(doc.Content[0], tt.path, value.Content[0])
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SetNode() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+			}
+			b, err := encode(&doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("unexpected yaml\n%s\nwant\n%s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkNode(t *testing.T) {
+	const doc = `cpu: 2
+network:
+  dns: [1.1.1.1, 8.8.8.8]
+base: &base
+  KEY: value
+env: *base
+docker:
+  debug: true
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	WalkNode("", node.Content[0], func(key string, _, _, _ *yaml.Node) bool {
+		keys = append(keys, key)
+		return key != "docker"
+	})
+	want := []string{"cpu", "network", "network.dns", "network.dns.0", "network.dns.1", "base", "base.KEY", "env", "env.KEY", "docker"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("WalkNode() keys = %v, want %v", keys, want)
+	}
+
+	values := NodeValues(node.Content[0])
+	if v := values["network.dns.1"]; v == nil || v.Value != "8.8.8.8" {
+		t.Errorf("NodeValues() network.dns.1 = %v", v)
+	}
+	if v := values["docker.debug"]; v == nil || v.Value != "true" {
+		t.Errorf("NodeValues() docker.debug = %v", v)
+	}
+}